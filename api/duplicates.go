@@ -0,0 +1,38 @@
+package api
+
+import (
+	"github.com/elgatito/elementum/bittorrent"
+	"github.com/elgatito/elementum/xbmc"
+)
+
+const (
+	duplicateCancel = iota
+	duplicatePlay
+	duplicateReplace
+	duplicateKeep
+)
+
+var duplicateLabels = map[int]int{
+	duplicatePlay:    30701,
+	duplicateReplace: 30702,
+	duplicateKeep:    30703,
+}
+
+// askDuplicate asks what to do with existing download of the same movie or episode
+func askDuplicate(xbmcHost *xbmc.XBMCHost, dup *bittorrent.Duplicate, canPlay bool) int {
+	actions := []int{duplicateReplace, duplicateKeep}
+	if canPlay {
+		actions = append([]int{duplicatePlay}, actions...)
+	}
+
+	choices := make([]string, 0, len(actions))
+	for _, action := range actions {
+		choices = append(choices, xbmcHost.GetLocalizedString(duplicateLabels[action]))
+	}
+
+	choice := xbmcHost.ListDialog("LOCALIZE[30700];;"+dup.Name(), choices...)
+	if choice < 0 || choice >= len(actions) {
+		return duplicateCancel
+	}
+	return actions[choice]
+}
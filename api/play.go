@@ -11,7 +11,10 @@ import (
 	"github.com/sanity-io/litter"
 
 	"github.com/elgatito/elementum/bittorrent"
+	"github.com/elgatito/elementum/config"
 	"github.com/elgatito/elementum/database"
+	"github.com/elgatito/elementum/providers"
+	"github.com/elgatito/elementum/tmdb"
 	"github.com/elgatito/elementum/util/ip"
 	"github.com/elgatito/elementum/xbmc"
 )
@@ -116,6 +119,39 @@ func Play(s *bittorrent.Service) gin.HandlerFunc {
 			}
 		}
 
+		// Another release of the same movie or episode could be already downloaded
+		if player.GetTorrent() == nil && uri != "" && xbmcHost != nil {
+			if dup := s.FindDuplicate(contentType, tmdbID, showID, seasonNumber, episodeNumber, resume); dup != nil {
+				switch askDuplicate(xbmcHost, dup, !params.Background) {
+				case duplicateCancel:
+					player.Close()
+					return
+				case duplicatePlay:
+					if dup.Torrent != nil {
+						player.Params().ResumeHash = dup.Torrent.InfoHash()
+						player.SetTorrent(dup.Torrent)
+					} else {
+						player.Close()
+						log.Infof("Playing existing file %s", dup.Path)
+						// Local path should not be modified as a relative URL
+						ctx.Header("Location", dup.Path)
+						ctx.Status(302)
+						return
+					}
+				case duplicateReplace:
+					if err := s.RemoveDuplicate(dup); err != nil {
+						log.Warningf("Could not remove duplicate %s: %s", dup.Name(), err)
+						xbmcHost.Notify("Elementum", err.Error(), config.AddonIcon())
+					}
+				}
+			}
+		}
+
+		// New torrents, started for a movie or an episode, can be replaced if buffering is stalled
+		if player.GetTorrent() == nil && uri != "" && !params.Background && ((contentType == movieType && tmdbID > 0) || (contentType == episodeType && showID > 0)) {
+			player.SetFallback(playFallback(xbmcHost, ctx.Request.Host, contentType, tmdbID, showID, seasonNumber, episodeNumber))
+		}
+
 		if player.Buffer() != nil || !player.HasChosenFile() || player.Params().Background {
 			player.Close()
 			return
@@ -126,6 +162,50 @@ func Play(s *bittorrent.Service) gin.HandlerFunc {
 	}
 }
 
+// playFallback returns alternative releases for the movie or the episode, from search cache or from silent search
+func playFallback(xbmcHost *xbmc.XBMCHost, callbackHost string, contentType string, tmdbID, showID, seasonNumber, episodeNumber int) bittorrent.FallbackFunc {
+	return func() []*bittorrent.TorrentFile {
+		cacheID := strconv.Itoa(tmdbID)
+		if contentType == episodeType {
+			cacheID = strconv.Itoa(showID) + "_" + strconv.Itoa(seasonNumber) + "_" + strconv.Itoa(episodeNumber)
+		}
+
+		if torrents, err := GetCachedTorrents(cacheID); err == nil && len(torrents) > 0 {
+			return torrents
+		}
+
+		var torrents []*bittorrent.TorrentFile
+		if contentType == movieType {
+			movie := tmdb.GetMovie(tmdbID, config.Get().Language)
+			if movie == nil {
+				return nil
+			}
+
+			torrents = providers.SearchMovieSilent(xbmcHost, providers.GetMovieSearchers(xbmcHost, callbackHost), movie, false)
+		} else {
+			show := tmdb.GetShow(showID, config.Get().Language)
+			if show == nil {
+				return nil
+			}
+			season := tmdb.GetSeason(showID, seasonNumber, config.Get().Language, len(show.Seasons), true)
+			if season == nil {
+				return nil
+			}
+			episode := season.GetEpisode(episodeNumber)
+			if episode == nil {
+				return nil
+			}
+
+			torrents = providers.SearchEpisodeSilent(xbmcHost, providers.GetEpisodeSearchers(xbmcHost, callbackHost), show, episode, false)
+		}
+
+		if len(torrents) > 0 {
+			SetCachedTorrents(cacheID, torrents)
+		}
+		return torrents
+	}
+}
+
 // PlayTorrent ...
 func PlayTorrent(ctx *gin.Context) {
 	defer perf.ScopeTimer()()
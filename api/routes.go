@@ -4,6 +4,7 @@ import (
 	"fmt"
 	"net/http"
 	"path/filepath"
+	"strings"
 	"time"
 
 	"github.com/elgatito/elementum/api/repository"
@@ -51,7 +52,8 @@ func CORS() gin.HandlerFunc {
 		c.Header("Access-Control-Allow-Headers", "Content-Type, Content-Length, Accept-Encoding, X-CSRF-Token, Authorization, accept, origin, Cache-Control, X-Requested-With")
 		c.Header("Access-Control-Allow-Methods", "POST, HEAD, PATCH, OPTIONS, GET, PUT")
 
-		if c.Request.Method == "OPTIONS" {
+		// WebDAV clients expect DAV capabilities in OPTIONS response
+		if c.Request.Method == "OPTIONS" && !strings.HasPrefix(c.Request.URL.Path, webdavPrefix+"/") {
 			c.AbortWithStatus(204)
 			return
 		}
@@ -99,6 +101,7 @@ func Routes(s *bittorrent.Service, shutdown func(code int)) *gin.Engine {
 
 	r.Any("/debug/all", bittorrent.DebugAll(s))
 	r.Any("/debug/bundle", bittorrent.DebugBundle(s))
+	r.Any("/debug/readers", bittorrent.DebugReaders(s))
 
 	r.Any("/reload", Reload(s))
 	r.Any("/notification", Notification(s))
@@ -134,10 +137,17 @@ func Routes(s *bittorrent.Service, shutdown func(code int)) *gin.Engine {
 		}
 	}
 
+	stats := r.Group("/stats")
+	{
+		stats.GET("", GetStats(s))
+		stats.GET("/view", ListStats(s))
+	}
+
 	torrents := r.Group("/torrents")
 	{
 		torrents.GET("/", ListTorrents(s))
 		torrents.Any("/add", AddTorrent(s))
+		torrents.Any("/preview", PreviewTorrent(s))
 		torrents.GET("/pause", PauseSession(s))
 		torrents.GET("/resume", ResumeSession(s))
 		torrents.GET("/move/:torrentId", MoveTorrent(s))
@@ -149,11 +159,44 @@ func Routes(s *bittorrent.Service, shutdown func(code int)) *gin.Engine {
 		torrents.GET("/selectfile/:torrentId", SelectFileTorrent(s, true))
 		torrents.GET("/downloadfile/:torrentId", SelectFileTorrent(s, false))
 		torrents.GET("/assign/:torrentId/:tmdbId", AssignTorrent(s))
+		torrents.GET("/:torrentId/details", GetTorrentDetails(s))
+		torrents.GET("/:torrentId/playlist.m3u8", GetTorrentPlaylist(s))
+		torrents.GET("/limits/:torrentId", GetTorrentLimits(s))
+		torrents.GET("/limits/:torrentId/set", SetTorrentLimits(s))
+		torrents.GET("/seeding/:torrentId", GetTorrentSeedPolicy(s))
+		torrents.GET("/seeding/:torrentId/set", SetTorrentSeedPolicy(s))
+		torrents.GET("/seeding/:torrentId/reset", ResetTorrentSeedPolicy(s))
+		torrents.GET("/bandwidth", GetBandwidthSchedule(s))
+		torrents.GET("/categories", ListCategories(s))
+		torrents.GET("/hooks", ListHooks(s))
+		torrents.GET("/category/:torrentId/set", SetTorrentCategory(s))
+		torrents.GET("/rename/:torrentId", GetTorrentRename(s))
+		torrents.GET("/rename/:torrentId/apply", RenameTorrentFiles(s))
+		torrents.GET("/trackers/:torrentId", ListTorrentTrackers(s))
+		torrents.GET("/trackers/:torrentId/edit", EditTorrentTrackers(s))
+		torrents.GET("/trackers/:torrentId/add", AddTorrentTrackers(s))
+		torrents.GET("/trackers/:torrentId/remove", RemoveTorrentTracker(s))
+		torrents.GET("/trackers/:torrentId/move", MoveTorrentTracker(s))
+		torrents.GET("/reannounce/:torrentId", ReannounceTorrent(s))
+		torrents.GET("/dht/:torrentId", AnnounceTorrentDHT(s))
+		torrents.GET("/recheck/:torrentId", RecheckTorrent(s))
+		torrents.GET("/pin/:torrentId", PinTorrent(s, true))
+		torrents.GET("/unpin/:torrentId", PinTorrent(s, false))
+		torrents.GET("/cleanup", CleanupTorrents(s))
+		torrents.GET("/queue/up/:torrentId", MoveQueueTorrent(s, bittorrent.QueueUp))
+		torrents.GET("/queue/down/:torrentId", MoveQueueTorrent(s, bittorrent.QueueDown))
+		torrents.GET("/queue/top/:torrentId", MoveQueueTorrent(s, bittorrent.QueueTop))
+		torrents.GET("/queue/bottom/:torrentId", MoveQueueTorrent(s, bittorrent.QueueBottom))
 
 		// Web UI json
 		torrents.GET("/list", ListTorrentsWeb(s))
 	}
 
+	r.Any(webdavPrefix+"/*path", WebDAV(s))
+	for _, method := range webdavMethods {
+		r.Handle(method, webdavPrefix+"/*path", WebDAV(s))
+	}
+
 	movies := r.Group("/movies")
 	{
 		movies.GET("/", MoviesIndex)
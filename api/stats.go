@@ -0,0 +1,100 @@
+package api
+
+import (
+	"fmt"
+
+	"github.com/anacrolix/missinggo/perf"
+	"github.com/dustin/go-humanize"
+	"github.com/gin-gonic/gin"
+
+	"github.com/elgatito/elementum/bittorrent"
+	"github.com/elgatito/elementum/xbmc"
+)
+
+// GetStats returns transfer history as JSON
+func GetStats(s *bittorrent.Service) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		defer perf.ScopeTimer()()
+
+		stats, err := s.GetStats()
+		if err != nil {
+			ctx.String(500, err.Error())
+			return
+		}
+
+		ctx.JSON(200, stats)
+	}
+}
+
+// ListStats shows transfer history in Kodi, optionally for one of the periods: daily, weekly, monthly, torrents
+func ListStats(s *bittorrent.Service) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		defer perf.ScopeTimer()()
+
+		stats, err := s.GetStats()
+		if err != nil {
+			ctx.Error(fmt.Errorf("Unable to get transfer stats: %s", err))
+			return
+		}
+
+		items := xbmc.ListItems{}
+		switch ctx.Query("period") {
+		case "daily":
+			items = append(items, statsPeriodItems(stats.Daily)...)
+		case "weekly":
+			items = append(items, statsPeriodItems(stats.Weekly)...)
+		case "monthly":
+			items = append(items, statsPeriodItems(stats.Monthly)...)
+		case "torrents":
+			for _, t := range stats.Torrents {
+				label := t.Name
+				if !t.Active {
+					label = fmt.Sprintf("[COLOR gray]%s[/COLOR]", t.Name)
+				}
+				items = append(items, &xbmc.ListItem{
+					Label:  label,
+					Label2: statsLabel(t.Downloaded, t.Uploaded, t.Ratio),
+					Path:   URLForXBMC("/stats/view"),
+				})
+			}
+		default:
+			items = append(items, statsPeriodItems([]*bittorrent.StatsPeriod{stats.Today, stats.Week, stats.Month, stats.AllTime})...)
+			for _, p := range [][]string{{"daily", "LOCALIZE[30749]"}, {"weekly", "LOCALIZE[30750]"}, {"monthly", "LOCALIZE[30751]"}, {"torrents", "LOCALIZE[30752]"}} {
+				items = append(items, &xbmc.ListItem{
+					Label: fmt.Sprintf("[B]%s[/B]", p[1]),
+					Path:  URLQuery(URLForXBMC("/stats/view"), "period", p[0]),
+				})
+			}
+		}
+
+		ctx.JSON(200, xbmc.NewView("", items))
+	}
+}
+
+// statsPeriodLabels are names of summary periods, other periods are dates
+var statsPeriodLabels = map[string]string{
+	"today":    "LOCALIZE[30745]",
+	"week":     "LOCALIZE[30746]",
+	"month":    "LOCALIZE[30747]",
+	"all_time": "LOCALIZE[30748]",
+}
+
+func statsPeriodItems(periods []*bittorrent.StatsPeriod) xbmc.ListItems {
+	items := xbmc.ListItems{}
+	for _, p := range periods {
+		label := p.Period
+		if l, ok := statsPeriodLabels[p.Period]; ok {
+			label = l
+		}
+
+		items = append(items, &xbmc.ListItem{
+			Label: fmt.Sprintf("%s: %s", label, statsLabel(p.Downloaded, p.Uploaded, p.Ratio)),
+			Path:  URLForXBMC("/stats/view"),
+		})
+	}
+	return items
+}
+
+func statsLabel(downloaded, uploaded int64, ratio float64) string {
+	return fmt.Sprintf("D: %s, U: %s, R: %.2f", humanize.Bytes(uint64(downloaded)), humanize.Bytes(uint64(uploaded)), ratio)
+}
@@ -29,7 +29,11 @@ func SubtitlesIndex(s *bittorrent.Service) gin.HandlerFunc {
 
 		// Check if we are reading a file from Elementum
 		if strings.HasPrefix(playingFile, ip.GetContextHTTPHost(ctx)) {
-			playingFile = strings.Replace(playingFile, ip.GetContextHTTPHost(ctx)+"/files", config.Get().DownloadPath, 1)
+			downloadPath := config.Get().DownloadPath
+			if p := s.GetActivePlayer(); p != nil && p.GetTorrent() != nil {
+				downloadPath = p.GetTorrent().GetSavePath()
+			}
+			playingFile = strings.Replace(playingFile, ip.GetContextHTTPHost(ctx)+"/files", downloadPath, 1)
 			// not QueryUnescape in order to treat "+" as "+" in file name on FS
 			playingFile, _ = url.PathUnescape(playingFile)
 		}
@@ -7,6 +7,7 @@ import (
 	"mime/multipart"
 	"os"
 	"path/filepath"
+	"sort"
 	"strconv"
 	"strings"
 	"time"
@@ -19,7 +20,9 @@ import (
 	"github.com/elgatito/elementum/bittorrent"
 	"github.com/elgatito/elementum/config"
 	"github.com/elgatito/elementum/database"
+	"github.com/elgatito/elementum/util"
 	"github.com/elgatito/elementum/util/ident"
+	"github.com/elgatito/elementum/util/ip"
 	"github.com/elgatito/elementum/xbmc"
 )
 
@@ -50,6 +53,43 @@ type TorrentsWeb struct {
 	SeedersTotal  int     `json:"seeders_total"`
 	Peers         int     `json:"peers"`
 	PeersTotal    int     `json:"peers_total"`
+
+	DownloadLimit  int `json:"download_limit"`
+	UploadLimit    int `json:"upload_limit"`
+	MaxConnections int `json:"max_connections"`
+
+	QueuePosition int `json:"queue_position"`
+
+	Category string `json:"category"`
+}
+
+// TorrentCategory ...
+type TorrentCategory struct {
+	*bittorrent.Category
+	Torrents int `json:"torrents"`
+}
+
+// TorrentLimits ...
+type TorrentLimits struct {
+	DownloadLimit  int `json:"download_limit"`
+	UploadLimit    int `json:"upload_limit"`
+	MaxConnections int `json:"max_connections"`
+
+	EffectiveDownloadLimit  int `json:"effective_download_limit"`
+	EffectiveUploadLimit    int `json:"effective_upload_limit"`
+	EffectiveMaxConnections int `json:"effective_max_connections"`
+}
+
+// TorrentSeedPolicy ...
+type TorrentSeedPolicy struct {
+	Policy          *database.SeedPolicy `json:"policy"`
+	EffectivePolicy database.SeedPolicy  `json:"effective_policy"`
+}
+
+var seedEndActions = map[string]int{
+	"pause":       bittorrent.SeedActionPause,
+	"remove":      bittorrent.SeedActionRemove,
+	"remove_data": bittorrent.SeedActionRemoveData,
 }
 
 // AddToTorrentsMap ...
@@ -227,10 +267,34 @@ func ListTorrents(s *bittorrent.Service) gin.HandlerFunc {
 			return
 		}
 
+		// Without category filter torrents are grouped into category folders,
+		// and only torrents without category are listed in the root.
+		category, filtered := ctx.GetQuery("category")
+		if !filtered {
+			for _, c := range torrentCategories(s) {
+				if c.Torrents == 0 {
+					continue
+				}
+
+				items = append(items, &xbmc.ListItem{
+					Label: fmt.Sprintf("[B]%s[/B] (%d)", c.Name, c.Torrents),
+					Path:  URLQuery(URLForXBMC("/torrents/"), "category", c.Name),
+				})
+			}
+
+			items = append(items, &xbmc.ListItem{
+				Label: "[B]LOCALIZE[30744][/B]",
+				Path:  URLForXBMC("/stats/view"),
+			})
+		}
+
 		for _, t := range s.GetTorrents() {
 			if t == nil || t.Closer.IsSet() || s.Closer.IsSet() {
 				continue
 			}
+			if t.GetCategory() != category {
+				continue
+			}
 
 			torrentName := t.Name()
 			progress := t.GetProgress()
@@ -270,8 +334,16 @@ func ListTorrents(s *bittorrent.Service) gin.HandlerFunc {
 
 			playURL := t.GetPlayURL("")
 
+			label := fmt.Sprintf("%.2f%% - [COLOR %s]%s[/COLOR] - %s", progress, color, status, torrentName)
+			if config.Get().MaxActiveDownloads > 0 || config.Get().MaxActiveSeeds > 0 {
+				label = fmt.Sprintf("#%d %s", t.GetQueuePosition(), label)
+			}
+			if limits := limitsLabel(t.GetEffectiveLimits()); limits != "" {
+				label += " " + limits
+			}
+
 			item := xbmc.ListItem{
-				Label: fmt.Sprintf("%.2f%% - [COLOR %s]%s[/COLOR] - %s", progress, color, status, torrentName),
+				Label: label,
 				Path:  playURL,
 				Info: &xbmc.ListItemInfo{
 					Title: torrentName,
@@ -284,9 +356,34 @@ func ListTorrents(s *bittorrent.Service) gin.HandlerFunc {
 				{"LOCALIZE[30232]", fmt.Sprintf("RunPlugin(%s)", URLForXBMC("/torrents/delete/%s", t.InfoHash()))},
 				{"LOCALIZE[30276]", fmt.Sprintf("RunPlugin(%s)", URLForXBMC("/torrents/delete/%s?files=true", t.InfoHash()))},
 				{"LOCALIZE[30308]", fmt.Sprintf("RunPlugin(%s)", URLForXBMC("/torrents/move/%s", t.InfoHash()))},
+				{"LOCALIZE[30706]", fmt.Sprintf("RunPlugin(%s)", URLForXBMC("/torrents/limits/%s/set", t.InfoHash()))},
+				{"LOCALIZE[30714]", fmt.Sprintf("RunPlugin(%s)", URLForXBMC("/torrents/seeding/%s/set", t.InfoHash()))},
+				{"LOCALIZE[30726]", fmt.Sprintf("RunPlugin(%s)", URLForXBMC("/torrents/category/%s/set", t.InfoHash()))},
+				{"LOCALIZE[30729]", fmt.Sprintf("RunPlugin(%s)", URLForXBMC("/torrents/rename/%s/apply", t.InfoHash()))},
+				{"LOCALIZE[30731]", fmt.Sprintf("RunPlugin(%s)", URLForXBMC("/torrents/trackers/%s/edit", t.InfoHash()))},
+				{"LOCALIZE[30741]", fmt.Sprintf("RunPlugin(%s)", URLForXBMC("/torrents/recheck/%s", t.InfoHash()))},
+				{"LOCALIZE[30742]", fmt.Sprintf("RunPlugin(%s)", URLForXBMC("/torrents/reannounce/%s", t.InfoHash()))},
+				{"LOCALIZE[30743]", fmt.Sprintf("RunPlugin(%s)", URLForXBMC("/torrents/dht/%s", t.InfoHash()))},
 				sessionAction,
 			}
 
+			if !t.IsMemoryStorage() {
+				if t.IsPinned() {
+					item.ContextMenu = append(item.ContextMenu, []string{"LOCALIZE[30756]", fmt.Sprintf("RunPlugin(%s)", URLForXBMC("/torrents/unpin/%s", t.InfoHash()))})
+				} else {
+					item.ContextMenu = append(item.ContextMenu, []string{"LOCALIZE[30757]", fmt.Sprintf("RunPlugin(%s)", URLForXBMC("/torrents/pin/%s", t.InfoHash()))})
+				}
+			}
+
+			if config.Get().MaxActiveDownloads > 0 || config.Get().MaxActiveSeeds > 0 {
+				item.ContextMenu = append(item.ContextMenu,
+					[]string{"LOCALIZE[30710]", fmt.Sprintf("RunPlugin(%s)", URLForXBMC("/torrents/queue/top/%s", t.InfoHash()))},
+					[]string{"LOCALIZE[30711]", fmt.Sprintf("RunPlugin(%s)", URLForXBMC("/torrents/queue/up/%s", t.InfoHash()))},
+					[]string{"LOCALIZE[30712]", fmt.Sprintf("RunPlugin(%s)", URLForXBMC("/torrents/queue/down/%s", t.InfoHash()))},
+					[]string{"LOCALIZE[30713]", fmt.Sprintf("RunPlugin(%s)", URLForXBMC("/torrents/queue/bottom/%s", t.InfoHash()))},
+				)
+			}
+
 			if !t.IsMemoryStorage() {
 				item.ContextMenu = append(item.ContextMenu, []string{"LOCALIZE[30573]", fmt.Sprintf("RunPlugin(%s)", URLForXBMC("/torrents/selectfile/%s", t.InfoHash()))})
 				item.ContextMenu = append(item.ContextMenu, []string{"LOCALIZE[30612]", fmt.Sprintf("RunPlugin(%s)", URLForXBMC("/torrents/downloadfile/%s", t.InfoHash()))})
@@ -323,13 +420,16 @@ func ListTorrentsWeb(s *bittorrent.Service) gin.HandlerFunc {
 			return
 		}
 
-		seedTimeLimit := config.Get().SeedTimeLimit
+		category, filtered := ctx.GetQuery("category")
 
 		for _, t := range s.GetTorrents() {
 			th := t.GetHandle()
 			if th == nil || !th.IsValid() || !t.HasMetadata() || t.Closer.IsSet() || s.Closer.IsSet() {
 				continue
 			}
+			if filtered && t.GetCategory() != category {
+				continue
+			}
 
 			torrentStatus := t.GetLastStatus(false)
 
@@ -367,6 +467,7 @@ func ListTorrentsWeb(s *bittorrent.Service) gin.HandlerFunc {
 			uploadRate := float64(torrentStatus.GetUploadPayloadRate()) / 1024
 
 			seeders, seedersTotal, peers, peersTotal := t.GetConnections()
+			downloadLimit, uploadLimit, maxConnections := t.GetEffectiveLimits()
 
 			ti := &TorrentsWeb{
 				ID:            infoHash,
@@ -381,7 +482,7 @@ func ListTorrentsWeb(s *bittorrent.Service) gin.HandlerFunc {
 				TimeRatio:     timeRatio,
 				SeedingTime:   seedingTime.String(),
 				SeedTime:      seedingTime.Seconds(),
-				SeedTimeLimit: seedTimeLimit,
+				SeedTimeLimit: t.GetSeedPolicy().SeedTimeLimit,
 				DownloadRate:  downloadRate,
 				UploadRate:    uploadRate,
 				TotalDownload: allTimeDownload,
@@ -390,10 +491,24 @@ func ListTorrentsWeb(s *bittorrent.Service) gin.HandlerFunc {
 				SeedersTotal:  seedersTotal,
 				Peers:         peers,
 				PeersTotal:    peersTotal,
+
+				DownloadLimit:  downloadLimit,
+				UploadLimit:    uploadLimit,
+				MaxConnections: maxConnections,
+
+				QueuePosition: t.GetQueuePosition(),
+
+				Category: t.GetCategory(),
 			}
 			items = append(items, ti)
 		}
 
+		if ctx.Query("group") == "category" {
+			sort.SliceStable(items, func(i, j int) bool {
+				return items[i].Category < items[j].Category
+			})
+		}
+
 		ctx.JSON(200, items)
 	}
 }
@@ -436,6 +551,19 @@ func AddTorrent(s *bittorrent.Service) gin.HandlerFunc {
 		uri := ctx.Request.FormValue("uri")
 		file, header, fileError := ctx.Request.FormFile("file")
 		allFiles := ctx.Request.FormValue("all")
+		category := ctx.Request.FormValue("category")
+
+		// Optional movie or episode, the torrent is downloaded for
+		contentType := ctx.Request.FormValue("type")
+		tmdbID, _ := strconv.Atoi(ctx.Request.FormValue("tmdb"))
+		showID, _ := strconv.Atoi(ctx.Request.FormValue("show"))
+		seasonNumber, _ := strconv.Atoi(ctx.Request.FormValue("season"))
+		episodeNumber, _ := strconv.Atoi(ctx.Request.FormValue("episode"))
+
+		if category != "" && s.GetCategory(category) == nil {
+			ctx.String(400, fmt.Sprintf("Unknown category: %s", category))
+			return
+		}
 
 		if file != nil && header != nil && fileError == nil {
 			t, err := saveTorrentFile(file, header)
@@ -465,17 +593,50 @@ func AddTorrent(s *bittorrent.Service) gin.HandlerFunc {
 			t = s.GetTorrentByHash(resume)
 		}
 
+		// Another release of the same movie or episode could be already downloaded,
+		// without Kodi the caller decides with "duplicate" parameter: "keep" or "replace".
+		if t == nil {
+			if dup := s.FindDuplicate(contentType, tmdbID, showID, seasonNumber, episodeNumber, resume); dup != nil {
+				action := duplicateCancel
+				if xbmcHost != nil {
+					action = askDuplicate(xbmcHost, dup, false)
+				} else if d := ctx.Request.FormValue("duplicate"); d == "keep" {
+					action = duplicateKeep
+				} else if d == "replace" {
+					action = duplicateReplace
+				}
+
+				switch action {
+				case duplicateCancel:
+					ctx.String(409, fmt.Sprintf("Already downloaded: %s", dup.Name()))
+					return
+				case duplicateReplace:
+					if err := s.RemoveDuplicate(dup); err != nil {
+						torrentsLog.Warningf("Could not remove duplicate %s: %s", dup.Name(), err)
+					}
+				}
+			}
+		}
+
 		if t == nil {
 			var err error
-			t, err = s.AddTorrent(xbmcHost, bittorrent.AddOptions{URI: uri, Paused: false, DownloadStorage: config.Get().DownloadStorage, FirstTime: true, AddedTime: time.Now()})
+			t, err = s.AddTorrent(xbmcHost, bittorrent.AddOptions{URI: uri, Paused: false, DownloadStorage: config.Get().DownloadStorage, FirstTime: true, AddedTime: time.Now(), Category: category})
 			if err != nil {
 				ctx.String(404, err.Error())
 				return
 			}
+		} else if category != "" && t.GetCategory() != category {
+			if err := t.SetCategory(category); err != nil {
+				torrentsLog.Warningf("Could not set category for %s: %s", t.Name(), err)
+			}
 		}
 
 		// Create initial BTItem entry
-		database.GetStorm().UpdateBTItem(t.InfoHash(), 0, "", []string{}, t.Name(), 0, 0, 0)
+		if (contentType == movieType && tmdbID > 0) || (contentType == episodeType && showID > 0) {
+			database.GetStorm().UpdateBTItem(t.InfoHash(), tmdbID, contentType, []string{}, t.Name(), showID, seasonNumber, episodeNumber)
+		} else {
+			database.GetStorm().UpdateBTItem(t.InfoHash(), 0, "", []string{}, t.Name(), 0, 0, 0)
+		}
 
 		torrentsLog.Infof("Downloading %s", uri)
 		if allFiles == "1" {
@@ -493,11 +654,47 @@ func AddTorrent(s *bittorrent.Service) gin.HandlerFunc {
 			}
 		}
 
-		xbmcHost.Refresh()
+		if xbmcHost != nil {
+			xbmcHost.Refresh()
+		}
 		ctx.String(200, "")
 	}
 }
 
+// PreviewTorrent fetches torrent metadata and returns files list, without starting a download.
+// Torrent is kept in the session for a few minutes, unless "keep" is set to false.
+func PreviewTorrent(s *bittorrent.Service) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		defer perf.ScopeTimer()()
+
+		uri := ctx.Request.FormValue("uri")
+		file, header, fileError := ctx.Request.FormFile("file")
+		keep := ctx.Request.FormValue("keep") != "false"
+
+		if file != nil && header != nil && fileError == nil {
+			t, err := saveTorrentFile(file, header)
+			if err == nil && t != "" {
+				uri = t
+			}
+		}
+
+		if uri == "" {
+			torrentsLog.Errorf("Torrent file/magnet url is empty")
+			ctx.String(404, "Missing torrent URI")
+			return
+		}
+		torrentsLog.Infof("Previewing torrent from %s", uri)
+
+		preview, err := s.PreviewTorrent(uri, keep)
+		if err != nil {
+			ctx.String(404, err.Error())
+			return
+		}
+
+		ctx.JSON(200, preview)
+	}
+}
+
 // ResumeTorrent ...
 func ResumeTorrent(s *bittorrent.Service) gin.HandlerFunc {
 	return func(ctx *gin.Context) {
@@ -583,8 +780,8 @@ func RemoveTorrent(s *bittorrent.Service) gin.HandlerFunc {
 	}
 }
 
-// DownloadAllTorrent ...
-func DownloadAllTorrent(s *bittorrent.Service) gin.HandlerFunc {
+// MoveQueueTorrent changes torrent position in the queue
+func MoveQueueTorrent(s *bittorrent.Service, direction int) gin.HandlerFunc {
 	return func(ctx *gin.Context) {
 		defer perf.ScopeTimer()()
 
@@ -593,42 +790,66 @@ func DownloadAllTorrent(s *bittorrent.Service) gin.HandlerFunc {
 		torrentID := ctx.Params.ByName("torrentId")
 		torrent, err := GetTorrentFromParam(s, torrentID)
 		if err != nil {
-			ctx.Error(fmt.Errorf("Unable to download all files for torrent with index %s", torrentID))
+			ctx.Error(fmt.Errorf("Unable to move in queue torrent with index %s", torrentID))
 			return
 		}
 
-		torrent.DownloadAllFiles()
-		torrent.SaveDBFiles()
+		if s.MoveInQueue(torrent, direction) {
+			s.UpdateQueue()
+		}
 
-		xbmcHost.Refresh()
+		if xbmcHost != nil {
+			xbmcHost.Refresh()
+		}
 		ctx.String(200, "")
 	}
 }
 
-// UnDownloadAllTorrent ...
-func UnDownloadAllTorrent(s *bittorrent.Service) gin.HandlerFunc {
+// GetTorrentDetails returns torrent state with files, pieces, trackers and readers as JSON
+func GetTorrentDetails(s *bittorrent.Service) gin.HandlerFunc {
 	return func(ctx *gin.Context) {
 		defer perf.ScopeTimer()()
 
-		xbmcHost, _ := xbmc.GetXBMCHostWithContext(ctx)
+		torrentID := ctx.Params.ByName("torrentId")
+		torrent, err := GetTorrentFromParam(s, torrentID)
+		if err != nil {
+			ctx.Error(fmt.Errorf("Unable to get details for torrent with index %s", torrentID))
+			return
+		}
+
+		details := torrent.Details()
+		if details == nil {
+			ctx.String(404, "Torrent is not active")
+			return
+		}
+
+		ctx.JSON(200, details)
+	}
+}
+
+// GetTorrentLimits returns per-torrent and effective limits
+func GetTorrentLimits(s *bittorrent.Service) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		defer perf.ScopeTimer()()
 
 		torrentID := ctx.Params.ByName("torrentId")
 		torrent, err := GetTorrentFromParam(s, torrentID)
 		if err != nil {
-			ctx.Error(fmt.Errorf("Unable to undownload all files for torrent with index %s", torrentID))
+			ctx.Error(fmt.Errorf("Unable to get limits for torrent with index %s", torrentID))
 			return
 		}
 
-		torrent.UnDownloadAllFiles()
-		torrent.SaveDBFiles()
+		limits := TorrentLimits{}
+		limits.DownloadLimit, limits.UploadLimit, limits.MaxConnections = torrent.GetLimits()
+		limits.EffectiveDownloadLimit, limits.EffectiveUploadLimit, limits.EffectiveMaxConnections = torrent.GetEffectiveLimits()
 
-		xbmcHost.Refresh()
-		ctx.String(200, "")
+		ctx.JSON(200, limits)
 	}
 }
 
-// SelectFileTorrent ...
-func SelectFileTorrent(s *bittorrent.Service, isPlay bool) gin.HandlerFunc {
+// SetTorrentLimits sets per-torrent rate limits (in KB/s) and connections cap.
+// Values, missing in the query, are asked with a keyboard dialog.
+func SetTorrentLimits(s *bittorrent.Service) gin.HandlerFunc {
 	return func(ctx *gin.Context) {
 		defer perf.ScopeTimer()()
 
@@ -637,86 +858,897 @@ func SelectFileTorrent(s *bittorrent.Service, isPlay bool) gin.HandlerFunc {
 		torrentID := ctx.Params.ByName("torrentId")
 		torrent, err := GetTorrentFromParam(s, torrentID)
 		if err != nil {
-			ctx.Error(fmt.Errorf("Unable to select files for torrent with index %s", torrentID))
+			ctx.Error(fmt.Errorf("Unable to set limits for torrent with index %s", torrentID))
 			return
 		}
 
-		file, choice, err := torrent.ChooseFile(nil)
-		if err == nil && file != nil {
-			if isPlay {
-				url := torrent.GetPlayURL(strconv.Itoa(choice))
-				log.Infof("Triggering play for: %s", url)
-				xbmcHost.PlayURL(url)
-			} else {
-				log.Infof("Triggering download for: %s", file.Path)
-				torrent.DownloadFile(file)
-				torrent.SaveDBFiles()
-				xbmcHost.Refresh()
+		downloadLimit, uploadLimit, maxConnections := torrent.GetLimits()
+
+		getValue := func(key, title string, current int) (int, error) {
+			value, exists := ctx.GetQuery(key)
+			if !exists {
+				if xbmcHost == nil {
+					return current, nil
+				}
+				if value = xbmcHost.Keyboard(strconv.Itoa(current), title); value == "" {
+					return current, nil
+				}
+			}
+
+			i, err := strconv.Atoi(strings.TrimSpace(value))
+			if err != nil || i < 0 {
+				return current, fmt.Errorf("Wrong value for %s: %s", key, value)
 			}
+			return i, nil
+		}
+
+		if downloadLimit, err = getValue("download", "LOCALIZE[30707]", downloadLimit/1024); err != nil {
+			ctx.String(400, err.Error())
+			return
+		}
+		if uploadLimit, err = getValue("upload", "LOCALIZE[30708]", uploadLimit/1024); err != nil {
+			ctx.String(400, err.Error())
+			return
+		}
+		if maxConnections, err = getValue("connections", "LOCALIZE[30709]", maxConnections); err != nil {
+			ctx.String(400, err.Error())
 			return
 		}
 
-		xbmcHost.Refresh()
+		torrent.SetLimits(downloadLimit*1024, uploadLimit*1024, maxConnections)
+
+		if xbmcHost != nil {
+			xbmcHost.Refresh()
+		}
 		ctx.String(200, "")
 	}
 }
 
-// Versions ...
-func Versions(s *bittorrent.Service) gin.HandlerFunc {
+// GetTorrentSeedPolicy returns per-torrent and effective seeding policy
+func GetTorrentSeedPolicy(s *bittorrent.Service) gin.HandlerFunc {
 	return func(ctx *gin.Context) {
-		type Versions struct {
-			Version   string `json:"version"`
-			UserAgent string `json:"user-agent"`
+		defer perf.ScopeTimer()()
+
+		torrentID := ctx.Params.ByName("torrentId")
+		torrent, err := GetTorrentFromParam(s, torrentID)
+		if err != nil {
+			ctx.Error(fmt.Errorf("Unable to get seeding policy for torrent with index %s", torrentID))
+			return
 		}
-		versions := Versions{
-			Version:   ident.GetVersion(),
-			UserAgent: s.UserAgent,
+
+		ret := TorrentSeedPolicy{
+			EffectivePolicy: torrent.GetSeedPolicy(),
 		}
-		ctx.JSON(200, versions)
+		if torrent.DBItem != nil {
+			ret.Policy = torrent.DBItem.SeedPolicy
+		}
+
+		ctx.JSON(200, ret)
 	}
 }
 
-// GetTorrentFromParam ...
-func GetTorrentFromParam(s *bittorrent.Service, param string) (*bittorrent.Torrent, error) {
-	if len(param) == 0 {
-		return nil, errors.New("Empty param")
-	}
+// SetTorrentSeedPolicy sets per-torrent seeding policy.
+// Query takes forever (bool), time (hours), time_ratio (%), ratio (%) and action (pause, remove, remove_data),
+// without query parameters a list of presets is shown.
+func SetTorrentSeedPolicy(s *bittorrent.Service) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		defer perf.ScopeTimer()()
 
-	defer perf.ScopeTimer()()
+		xbmcHost, _ := xbmc.GetXBMCHostWithContext(ctx)
 
-	t := s.GetTorrentByHash(param)
-	if t == nil {
-		return nil, errors.New("Torrent not found")
-	}
-	return t, nil
-}
+		torrentID := ctx.Params.ByName("torrentId")
+		torrent, err := GetTorrentFromParam(s, torrentID)
+		if err != nil {
+			ctx.Error(fmt.Errorf("Unable to set seeding policy for torrent with index %s", torrentID))
+			return
+		}
 
-func saveTorrentFile(file multipart.File, header *multipart.FileHeader) (string, error) {
-	if file == nil || header == nil {
-		return "", fmt.Errorf("Not a valid file entry")
+		policy := torrent.GetSeedPolicy()
+		if len(ctx.Request.URL.Query()) == 0 {
+			if xbmcHost == nil {
+				ctx.String(400, "No seeding policy parameters provided")
+				return
+			}
+
+			presets := localizedStrings(xbmcHost, 30716, 30717, 30718, 30719, 30720, 30721)
+			choice := xbmcHost.ListDialog("LOCALIZE[30715]", presets...)
+			switch choice {
+			case 0:
+				torrent.SetSeedPolicy(nil)
+				xbmcHost.Refresh()
+				ctx.String(200, "")
+				return
+			case 1:
+				policy = database.SeedPolicy{SeedForever: true}
+			case 2:
+				policy = database.SeedPolicy{SeedTimeLimit: 3600}
+			case 3:
+				policy = database.SeedPolicy{SeedTimeLimit: 24 * 3600}
+			case 4:
+				policy = database.SeedPolicy{ShareRatioLimit: 100}
+			case 5:
+				policy = database.SeedPolicy{ShareRatioLimit: 200}
+			default:
+				ctx.String(200, "")
+				return
+			}
+
+			if !policy.SeedForever {
+				actions := localizedStrings(xbmcHost, 30723, 30724, 30725)
+				action := xbmcHost.ListDialog("LOCALIZE[30722]", actions...)
+				if action < 0 {
+					ctx.String(200, "")
+					return
+				}
+				policy.EndAction = action
+			}
+		} else {
+			getValue := func(key string, current int) (int, error) {
+				value, exists := ctx.GetQuery(key)
+				if !exists {
+					return current, nil
+				}
+
+				i, err := strconv.Atoi(strings.TrimSpace(value))
+				if err != nil || i < 0 {
+					return current, fmt.Errorf("Wrong value for %s: %s", key, value)
+				}
+				return i, nil
+			}
+
+			if forever, exists := ctx.GetQuery("forever"); exists {
+				policy.SeedForever = forever == "true" || forever == "1"
+			}
+			seedTime, err := getValue("time", policy.SeedTimeLimit/3600)
+			if err != nil {
+				ctx.String(400, err.Error())
+				return
+			}
+			policy.SeedTimeLimit = seedTime * 3600
+			if policy.SeedTimeRatioLimit, err = getValue("time_ratio", policy.SeedTimeRatioLimit); err != nil {
+				ctx.String(400, err.Error())
+				return
+			}
+			if policy.ShareRatioLimit, err = getValue("ratio", policy.ShareRatioLimit); err != nil {
+				ctx.String(400, err.Error())
+				return
+			}
+			if action, exists := ctx.GetQuery("action"); exists {
+				endAction, ok := seedEndActions[action]
+				if !ok {
+					ctx.String(400, fmt.Sprintf("Wrong value for action: %s", action))
+					return
+				}
+				policy.EndAction = endAction
+			}
+		}
+
+		torrent.SetSeedPolicy(&policy)
+
+		if xbmcHost != nil {
+			xbmcHost.Refresh()
+		}
+		ctx.String(200, "")
 	}
+}
 
-	defer perf.ScopeTimer()()
+// ResetTorrentSeedPolicy removes per-torrent seeding policy, so global settings are used
+func ResetTorrentSeedPolicy(s *bittorrent.Service) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		defer perf.ScopeTimer()()
 
-	var err error
-	path := filepath.Join(config.Get().TorrentsPath, filepath.Base(header.Filename))
-	log.Debugf("Saving incoming torrent file to: %s", path)
+		xbmcHost, _ := xbmc.GetXBMCHostWithContext(ctx)
 
-	if _, err = os.Stat(path); err != nil && !os.IsNotExist(err) {
-		err = os.Remove(path)
+		torrentID := ctx.Params.ByName("torrentId")
+		torrent, err := GetTorrentFromParam(s, torrentID)
 		if err != nil {
-			return "", fmt.Errorf("Could not remove the file: %s", err)
+			ctx.Error(fmt.Errorf("Unable to reset seeding policy for torrent with index %s", torrentID))
+			return
+		}
+
+		torrent.SetSeedPolicy(nil)
+
+		if xbmcHost != nil {
+			xbmcHost.Refresh()
 		}
+		ctx.String(200, "")
 	}
+}
 
-	out, err := os.Create(path)
-	if err != nil {
-		return "", fmt.Errorf("Could not create file: %s", err)
+// ListCategories returns defined categories with torrents count
+func ListCategories(s *bittorrent.Service) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		defer perf.ScopeTimer()()
+
+		ctx.JSON(200, torrentCategories(s))
 	}
-	defer out.Close()
-	if _, err = io.Copy(out, file); err != nil {
-		return "", fmt.Errorf("Could not write file content: %s", err)
+}
+
+// ListHooks returns defined completion hooks with their execution logs
+func ListHooks(s *bittorrent.Service) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		defer perf.ScopeTimer()()
+
+		ctx.JSON(200, s.GetHooks())
 	}
+}
 
-	return path, nil
+// SetTorrentCategory sets torrent category from query, or asks to choose one from the list
+func SetTorrentCategory(s *bittorrent.Service) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		defer perf.ScopeTimer()()
+
+		xbmcHost, _ := xbmc.GetXBMCHostWithContext(ctx)
+
+		torrentID := ctx.Params.ByName("torrentId")
+		torrent, err := GetTorrentFromParam(s, torrentID)
+		if err != nil {
+			ctx.Error(fmt.Errorf("Unable to set category for torrent with index %s", torrentID))
+			return
+		}
+
+		category, exists := ctx.GetQuery("category")
+		if !exists {
+			if xbmcHost == nil {
+				ctx.String(400, "Missing category")
+				return
+			}
+
+			categories := s.GetCategories()
+			choices := localizedStrings(xbmcHost, 30728)
+			for _, c := range categories {
+				choices = append(choices, c.Name)
+			}
+
+			choice := xbmcHost.ListDialog("LOCALIZE[30727]", choices...)
+			if choice < 0 {
+				ctx.String(200, "")
+				return
+			} else if choice > 0 {
+				category = categories[choice-1].Name
+			}
+		}
+
+		if err := torrent.SetCategory(category); err != nil {
+			ctx.String(400, err.Error())
+			return
+		}
+
+		if xbmcHost != nil {
+			xbmcHost.Refresh()
+		}
+		ctx.String(200, "")
+	}
+}
+
+// GetTorrentRename returns target names for torrent files, according to rename templates
+func GetTorrentRename(s *bittorrent.Service) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		defer perf.ScopeTimer()()
+
+		torrentID := ctx.Params.ByName("torrentId")
+		torrent, err := GetTorrentFromParam(s, torrentID)
+		if err != nil {
+			ctx.Error(fmt.Errorf("Unable to get rename for torrent with index %s", torrentID))
+			return
+		}
+
+		files, err := torrent.OrganizeFiles(database.GetStorm().GetBTItem(torrent.InfoHash()))
+		if err != nil {
+			ctx.String(400, err.Error())
+			return
+		}
+
+		ctx.JSON(200, files)
+	}
+}
+
+// RenameTorrentFiles renames torrent files according to rename templates, torrent keeps seeding
+func RenameTorrentFiles(s *bittorrent.Service) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		defer perf.ScopeTimer()()
+
+		xbmcHost, _ := xbmc.GetXBMCHostWithContext(ctx)
+
+		torrentID := ctx.Params.ByName("torrentId")
+		torrent, err := GetTorrentFromParam(s, torrentID)
+		if err != nil {
+			ctx.Error(fmt.Errorf("Unable to rename files for torrent with index %s", torrentID))
+			return
+		}
+
+		files, err := torrent.OrganizeFiles(database.GetStorm().GetBTItem(torrent.InfoHash()))
+		if err != nil {
+			if xbmcHost != nil {
+				xbmcHost.Notify("Elementum", err.Error(), config.AddonIcon())
+			}
+			ctx.String(400, err.Error())
+			return
+		}
+
+		if xbmcHost != nil && !xbmcHost.DialogConfirm("Elementum", fmt.Sprintf("LOCALIZE[30730];;%d;;%s", len(files), torrent.Name())) {
+			ctx.String(200, "")
+			return
+		}
+
+		if err := torrent.RenameFiles(files); err != nil {
+			ctx.String(400, err.Error())
+			return
+		}
+
+		if xbmcHost != nil {
+			xbmcHost.Refresh()
+		}
+		ctx.String(200, "")
+	}
+}
+
+// ListTorrentTrackers returns torrent trackers with announce state
+func ListTorrentTrackers(s *bittorrent.Service) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		defer perf.ScopeTimer()()
+
+		torrentID := ctx.Params.ByName("torrentId")
+		torrent, err := GetTorrentFromParam(s, torrentID)
+		if err != nil {
+			ctx.Error(fmt.Errorf("Unable to get trackers for torrent with index %s", torrentID))
+			return
+		}
+
+		ctx.JSON(200, torrent.GetTrackers())
+	}
+}
+
+// AddTorrentTrackers adds trackers from query, or asks to enter one
+func AddTorrentTrackers(s *bittorrent.Service) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		defer perf.ScopeTimer()()
+
+		xbmcHost, _ := xbmc.GetXBMCHostWithContext(ctx)
+
+		torrentID := ctx.Params.ByName("torrentId")
+		torrent, err := GetTorrentFromParam(s, torrentID)
+		if err != nil {
+			ctx.Error(fmt.Errorf("Unable to add trackers for torrent with index %s", torrentID))
+			return
+		}
+
+		urls := ctx.QueryArray("url")
+		if len(urls) == 0 {
+			if xbmcHost == nil {
+				ctx.String(400, "Missing url")
+				return
+			}
+			if u := xbmcHost.Keyboard("", "LOCALIZE[30733]"); u != "" {
+				urls = append(urls, u)
+			} else {
+				ctx.String(200, "")
+				return
+			}
+		}
+
+		if err := torrent.AddTrackers(urls); err != nil {
+			ctx.String(400, err.Error())
+			return
+		}
+
+		if xbmcHost != nil {
+			xbmcHost.Refresh()
+		}
+		ctx.String(200, "")
+	}
+}
+
+// RemoveTorrentTracker removes tracker, set in query
+func RemoveTorrentTracker(s *bittorrent.Service) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		defer perf.ScopeTimer()()
+
+		torrentID := ctx.Params.ByName("torrentId")
+		torrent, err := GetTorrentFromParam(s, torrentID)
+		if err != nil {
+			ctx.Error(fmt.Errorf("Unable to remove tracker for torrent with index %s", torrentID))
+			return
+		}
+
+		if err := torrent.RemoveTracker(ctx.Query("url")); err != nil {
+			ctx.String(400, err.Error())
+			return
+		}
+
+		ctx.String(200, "")
+	}
+}
+
+// MoveTorrentTracker moves tracker, set in query, to a new position
+func MoveTorrentTracker(s *bittorrent.Service) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		defer perf.ScopeTimer()()
+
+		torrentID := ctx.Params.ByName("torrentId")
+		torrent, err := GetTorrentFromParam(s, torrentID)
+		if err != nil {
+			ctx.Error(fmt.Errorf("Unable to move tracker for torrent with index %s", torrentID))
+			return
+		}
+
+		position, err := strconv.Atoi(ctx.Query("position"))
+		if err != nil {
+			ctx.String(400, "Wrong position")
+			return
+		}
+
+		if err := torrent.MoveTracker(ctx.Query("url"), position); err != nil {
+			ctx.String(400, err.Error())
+			return
+		}
+
+		ctx.String(200, "")
+	}
+}
+
+// ReannounceTorrent forces announce to tracker, set in query, or to all trackers
+func ReannounceTorrent(s *bittorrent.Service) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		defer perf.ScopeTimer()()
+
+		xbmcHost, _ := xbmc.GetXBMCHostWithContext(ctx)
+
+		torrentID := ctx.Params.ByName("torrentId")
+		torrent, err := GetTorrentFromParam(s, torrentID)
+		if err != nil {
+			ctx.Error(fmt.Errorf("Unable to reannounce torrent with index %s", torrentID))
+			return
+		}
+
+		if u := ctx.Query("url"); u != "" {
+			err = torrent.ReannounceTracker(u)
+		} else {
+			err = torrent.Reannounce()
+		}
+		if err != nil {
+			ctx.String(400, err.Error())
+			return
+		}
+
+		if xbmcHost != nil {
+			xbmcHost.Refresh()
+		}
+		ctx.String(200, "")
+	}
+}
+
+// AnnounceTorrentDHT forces announce to DHT
+func AnnounceTorrentDHT(s *bittorrent.Service) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		defer perf.ScopeTimer()()
+
+		xbmcHost, _ := xbmc.GetXBMCHostWithContext(ctx)
+
+		torrentID := ctx.Params.ByName("torrentId")
+		torrent, err := GetTorrentFromParam(s, torrentID)
+		if err != nil {
+			ctx.Error(fmt.Errorf("Unable to announce to DHT torrent with index %s", torrentID))
+			return
+		}
+
+		if err := torrent.AnnounceDHT(); err != nil {
+			if xbmcHost != nil {
+				xbmcHost.Notify("Elementum", err.Error(), config.AddonIcon())
+			}
+			ctx.String(400, err.Error())
+			return
+		}
+
+		if xbmcHost != nil {
+			xbmcHost.Refresh()
+		}
+		ctx.String(200, "")
+	}
+}
+
+// RecheckTorrent forces verification of downloaded data, in Kodi check progress is shown until it is done
+func RecheckTorrent(s *bittorrent.Service) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		defer perf.ScopeTimer()()
+
+		xbmcHost, _ := xbmc.GetXBMCHostWithContext(ctx)
+
+		torrentID := ctx.Params.ByName("torrentId")
+		torrent, err := GetTorrentFromParam(s, torrentID)
+		if err != nil {
+			ctx.Error(fmt.Errorf("Unable to recheck torrent with index %s", torrentID))
+			return
+		}
+
+		if err := torrent.ForceRecheck(); err != nil {
+			if xbmcHost != nil {
+				xbmcHost.Notify("Elementum", err.Error(), config.AddonIcon())
+			}
+			ctx.String(400, err.Error())
+			return
+		}
+
+		if xbmcHost != nil {
+			go watchRecheck(xbmcHost, torrent)
+			xbmcHost.Refresh()
+		}
+		ctx.String(200, "")
+	}
+}
+
+// watchRecheck shows check progress in background dialog, while torrent is in checking state
+func watchRecheck(xbmcHost *xbmc.XBMCHost, t *bittorrent.Torrent) {
+	dialog := xbmcHost.NewDialogProgressBG("Elementum", "")
+	if dialog == nil {
+		return
+	}
+	defer dialog.Close()
+
+	ticker := time.NewTicker(time.Second)
+	defer ticker.Stop()
+
+	// Check is started asynchronously, so torrent may not be in checking state right away
+	started := false
+	for i := 0; ; i++ {
+		<-ticker.C
+		if t.Closer.IsSet() {
+			return
+		}
+
+		checking, progress := t.CheckProgress()
+		if checking {
+			started = true
+		} else if started || i >= 5 {
+			break
+		}
+
+		dialog.Update(int(progress), "Elementum", fmt.Sprintf("%s: %.2f%%", xbmcHost.Translate(bittorrent.StatusStrings[bittorrent.StatusChecking]), progress))
+	}
+
+	xbmcHost.Notify("Elementum", fmt.Sprintf("%s: %.2f%%", t.Name(), t.GetProgress()), config.AddonIcon())
+	xbmcHost.Refresh()
+}
+
+// EditTorrentTrackers shows dialogs to edit torrent trackers in Kodi
+func EditTorrentTrackers(s *bittorrent.Service) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		defer perf.ScopeTimer()()
+
+		xbmcHost, err := xbmc.GetXBMCHostWithContext(ctx)
+		if xbmcHost == nil || err != nil {
+			ctx.String(400, "Kodi is not available")
+			return
+		}
+
+		torrentID := ctx.Params.ByName("torrentId")
+		torrent, err := GetTorrentFromParam(s, torrentID)
+		if err != nil {
+			ctx.Error(fmt.Errorf("Unable to edit trackers for torrent with index %s", torrentID))
+			return
+		}
+
+		trackers := torrent.GetTrackers()
+		labels := localizedStrings(xbmcHost, 30734, 30735, 30736, 30737)
+		choices := []string{labels[0], labels[1]}
+		for _, t := range trackers {
+			status := fmt.Sprintf("[COLOR red]%s[/COLOR]", labels[3])
+			if t.Working {
+				status = fmt.Sprintf("[COLOR green]%s[/COLOR]", labels[2])
+			}
+			choices = append(choices, fmt.Sprintf("%s | %s", status, t.URL))
+		}
+
+		choice := xbmcHost.ListDialog("LOCALIZE[30732]", choices...)
+		switch {
+		case choice < 0:
+		case choice == 0:
+			if u := xbmcHost.Keyboard("", "LOCALIZE[30733]"); u != "" {
+				err = torrent.AddTrackers([]string{u})
+			}
+		case choice == 1:
+			err = torrent.Reannounce()
+		default:
+			idx := choice - 2
+			u := trackers[idx].URL
+			switch xbmcHost.ListDialog(u, append(localizedStrings(xbmcHost, 30738, 30739, 30740), labels[1])...) {
+			case 0:
+				err = torrent.RemoveTracker(u)
+			case 1:
+				err = torrent.MoveTracker(u, idx-1)
+			case 2:
+				err = torrent.MoveTracker(u, idx+1)
+			case 3:
+				err = torrent.ReannounceTracker(u)
+			}
+		}
+
+		if err != nil {
+			xbmcHost.Notify("Elementum", err.Error(), config.AddonIcon())
+			ctx.String(400, err.Error())
+			return
+		}
+
+		ctx.String(200, "")
+	}
+}
+
+// torrentCategories returns defined categories and categories that are assigned to torrents, but not defined anymore
+func torrentCategories(s *bittorrent.Service) []*TorrentCategory {
+	ret := []*TorrentCategory{}
+	index := map[string]*TorrentCategory{}
+	for _, c := range s.GetCategories() {
+		tc := &TorrentCategory{Category: c}
+		index[c.Name] = tc
+		ret = append(ret, tc)
+	}
+
+	for _, t := range s.GetTorrents() {
+		if t == nil {
+			continue
+		}
+
+		name := t.GetCategory()
+		if name == "" {
+			continue
+		}
+
+		tc, ok := index[name]
+		if !ok {
+			tc = &TorrentCategory{Category: &bittorrent.Category{Name: name}}
+			index[name] = tc
+			ret = append(ret, tc)
+		}
+		tc.Torrents++
+	}
+
+	return ret
+}
+
+// GetBandwidthSchedule returns active bandwidth profile and session-wide limits
+func GetBandwidthSchedule(s *bittorrent.Service) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		defer perf.ScopeTimer()()
+
+		type BandwidthSchedule struct {
+			Enabled       bool                          `json:"enabled"`
+			ActiveProfile string                        `json:"active_profile"`
+			DownloadLimit int                           `json:"download_limit"`
+			UploadLimit   int                           `json:"upload_limit"`
+			Schedule      *bittorrent.BandwidthSchedule `json:"schedule"`
+		}
+
+		ret := BandwidthSchedule{
+			Enabled:       config.Get().BandwidthScheduleEnabled,
+			ActiveProfile: s.GetActiveRateProfile(),
+			Schedule:      s.GetBandwidthSchedule(),
+		}
+		ret.DownloadLimit, ret.UploadLimit = s.GetRateLimits()
+
+		ctx.JSON(200, ret)
+	}
+}
+
+func limitsLabel(downloadLimit, uploadLimit, maxConnections int) string {
+	ret := []string{}
+	if downloadLimit > 0 {
+		ret = append(ret, fmt.Sprintf("D:%s/s", humanize.Bytes(uint64(downloadLimit))))
+	}
+	if uploadLimit > 0 {
+		ret = append(ret, fmt.Sprintf("U:%s/s", humanize.Bytes(uint64(uploadLimit))))
+	}
+	if maxConnections > 0 {
+		ret = append(ret, fmt.Sprintf("C:%d", maxConnections))
+	}
+	if len(ret) == 0 {
+		return ""
+	}
+
+	return "[COLOR grey][" + strings.Join(ret, " ") + "][/COLOR]"
+}
+
+// DownloadAllTorrent ...
+func DownloadAllTorrent(s *bittorrent.Service) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		defer perf.ScopeTimer()()
+
+		xbmcHost, _ := xbmc.GetXBMCHostWithContext(ctx)
+
+		torrentID := ctx.Params.ByName("torrentId")
+		torrent, err := GetTorrentFromParam(s, torrentID)
+		if err != nil {
+			ctx.Error(fmt.Errorf("Unable to download all files for torrent with index %s", torrentID))
+			return
+		}
+
+		torrent.DownloadAllFiles()
+		torrent.SaveDBFiles()
+
+		xbmcHost.Refresh()
+		ctx.String(200, "")
+	}
+}
+
+// UnDownloadAllTorrent ...
+func UnDownloadAllTorrent(s *bittorrent.Service) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		defer perf.ScopeTimer()()
+
+		xbmcHost, _ := xbmc.GetXBMCHostWithContext(ctx)
+
+		torrentID := ctx.Params.ByName("torrentId")
+		torrent, err := GetTorrentFromParam(s, torrentID)
+		if err != nil {
+			ctx.Error(fmt.Errorf("Unable to undownload all files for torrent with index %s", torrentID))
+			return
+		}
+
+		torrent.UnDownloadAllFiles()
+		torrent.SaveDBFiles()
+
+		xbmcHost.Refresh()
+		ctx.String(200, "")
+	}
+}
+
+// SelectFileTorrent ...
+func SelectFileTorrent(s *bittorrent.Service, isPlay bool) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		defer perf.ScopeTimer()()
+
+		xbmcHost, _ := xbmc.GetXBMCHostWithContext(ctx)
+
+		torrentID := ctx.Params.ByName("torrentId")
+		torrent, err := GetTorrentFromParam(s, torrentID)
+		if err != nil {
+			ctx.Error(fmt.Errorf("Unable to select files for torrent with index %s", torrentID))
+			return
+		}
+
+		file, choice, err := torrent.ChooseFile(nil)
+		if err == nil && file != nil {
+			if isPlay {
+				url := torrent.GetPlayURL(strconv.Itoa(choice))
+				log.Infof("Triggering play for: %s", url)
+				xbmcHost.PlayURL(url)
+			} else {
+				log.Infof("Triggering download for: %s", file.Path)
+				torrent.DownloadFile(file)
+				torrent.SaveDBFiles()
+				xbmcHost.Refresh()
+			}
+			return
+		}
+
+		xbmcHost.Refresh()
+		ctx.String(200, "")
+	}
+}
+
+// Versions ...
+func Versions(s *bittorrent.Service) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		type Versions struct {
+			Version   string `json:"version"`
+			UserAgent string `json:"user-agent"`
+		}
+		versions := Versions{
+			Version:   ident.GetVersion(),
+			UserAgent: s.UserAgent,
+		}
+		ctx.JSON(200, versions)
+	}
+}
+
+// GetTorrentFromParam ...
+func GetTorrentFromParam(s *bittorrent.Service, param string) (*bittorrent.Torrent, error) {
+	if len(param) == 0 {
+		return nil, errors.New("Empty param")
+	}
+
+	defer perf.ScopeTimer()()
+
+	t := s.GetTorrentByHash(param)
+	if t == nil {
+		return nil, errors.New("Torrent not found")
+	}
+	return t, nil
+}
+
+func saveTorrentFile(file multipart.File, header *multipart.FileHeader) (string, error) {
+	if file == nil || header == nil {
+		return "", fmt.Errorf("Not a valid file entry")
+	}
+
+	defer perf.ScopeTimer()()
+
+	var err error
+	path := filepath.Join(config.Get().TorrentsPath, filepath.Base(header.Filename))
+	log.Debugf("Saving incoming torrent file to: %s", path)
+
+	if _, err = os.Stat(path); err != nil && !os.IsNotExist(err) {
+		err = os.Remove(path)
+		if err != nil {
+			return "", fmt.Errorf("Could not remove the file: %s", err)
+		}
+	}
+
+	out, err := os.Create(path)
+	if err != nil {
+		return "", fmt.Errorf("Could not create file: %s", err)
+	}
+	defer out.Close()
+	if _, err = io.Copy(out, file); err != nil {
+		return "", fmt.Errorf("Could not write file content: %s", err)
+	}
+
+	return path, nil
+}
+
+// PinTorrent sets or clears pin flag, pinned torrents are never removed by cleanup policy
+func PinTorrent(s *bittorrent.Service, pinned bool) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		defer perf.ScopeTimer()()
+
+		xbmcHost, _ := xbmc.GetXBMCHostWithContext(ctx)
+
+		torrentID := ctx.Params.ByName("torrentId")
+		torrent, err := GetTorrentFromParam(s, torrentID)
+		if err != nil {
+			ctx.Error(fmt.Errorf("Unable to pin torrent with index %s", torrentID))
+			return
+		}
+
+		if err := torrent.SetPinned(pinned); err != nil {
+			ctx.String(400, err.Error())
+			return
+		}
+
+		if xbmcHost != nil {
+			xbmcHost.Refresh()
+		}
+		ctx.String(200, "")
+	}
+}
+
+// CleanupTorrents returns cleanup policy report, torrents are only removed with dry_run=false
+func CleanupTorrents(s *bittorrent.Service) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		defer perf.ScopeTimer()()
+
+		dryRun := ctx.DefaultQuery("dry_run", "true") != "false"
+		ctx.JSON(200, s.Cleanup(dryRun))
+	}
+}
+
+// GetTorrentPlaylist returns M3U8 playlist with playable files of the torrent, for external players
+func GetTorrentPlaylist(s *bittorrent.Service) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		defer perf.ScopeTimer()()
+
+		torrentID := ctx.Params.ByName("torrentId")
+		torrent, err := GetTorrentFromParam(s, torrentID)
+		if err != nil {
+			ctx.Error(fmt.Errorf("Unable to get playlist for torrent with index %s", torrentID))
+			return
+		}
+
+		items, err := torrent.Playlist()
+		if err != nil {
+			ctx.String(404, err.Error())
+			return
+		}
+
+		host := ip.GetContextHTTPHost(ctx)
+		playlist := strings.Builder{}
+		playlist.WriteString("#EXTM3U\n")
+		for _, i := range items {
+			// Line breaks would break the playlist format
+			title := strings.NewReplacer("\r", " ", "\n", " ").Replace(i.Title)
+			playlist.WriteString(fmt.Sprintf("#EXTINF:-1,%s\n%s/files/%s\n", title, host, util.EncodeFileURL(i.File.Path)))
+		}
+
+		ctx.Header("Content-Disposition", fmt.Sprintf("inline; filename=\"%s.m3u8\"", torrent.InfoHash()))
+		ctx.Data(200, "application/vnd.apple.mpegurl; charset=utf-8", []byte(playlist.String()))
+	}
 }
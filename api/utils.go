@@ -23,6 +23,15 @@ import (
 //
 // }
 
+// localizedStrings returns translated strings, to be used as list dialog items
+func localizedStrings(xbmcHost *xbmc.XBMCHost, ids ...int) []string {
+	ret := make([]string, 0, len(ids))
+	for _, id := range ids {
+		ret = append(ret, xbmcHost.GetLocalizedString(id))
+	}
+	return ret
+}
+
 func filterListItems(l xbmc.ListItems) xbmc.ListItems {
 	t := config.Get().TraktToken != ""
 
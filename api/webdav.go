@@ -0,0 +1,70 @@
+package api
+
+import (
+	"net/http"
+	"path"
+
+	"github.com/gin-gonic/gin"
+	"golang.org/x/net/webdav"
+
+	"github.com/elgatito/elementum/bittorrent"
+	"github.com/elgatito/elementum/util"
+)
+
+const (
+	webdavPrefix = "/webdav"
+	webdavAllow  = "OPTIONS, GET, HEAD, PROPFIND"
+)
+
+// webdavMethods are routed to WebDAV handler, besides the ones of gin Any()
+var webdavMethods = []string{"PROPFIND", "PROPPATCH", "MKCOL", "COPY", "MOVE", "LOCK", "UNLOCK"}
+
+var webdavLocks = webdav.NewMemLS()
+
+// WebDAV serves read-only share of active torrents files, with the same tree as in download path
+func WebDAV(s *bittorrent.Service) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		switch ctx.Request.Method {
+		case http.MethodOptions:
+			// Only class 1 is supported, locks are not needed for read-only share
+			ctx.Header("Allow", webdavAllow)
+			ctx.Header("DAV", "1")
+			ctx.Header("MS-Author-Via", "DAV")
+			ctx.String(http.StatusOK, "")
+			return
+
+		case "PROPFIND":
+			switch ctx.GetHeader("Depth") {
+			case "0", "1":
+			case "":
+				ctx.Request.Header.Set("Depth", "1")
+			default:
+				ctx.String(http.StatusForbidden, "Only Depth 0 and 1 are supported")
+				return
+			}
+
+		case http.MethodGet, http.MethodHead:
+			// Handler sniffs content of files without known extension, that reads pieces from the torrent
+			if name := path.Base(ctx.Request.URL.Path); path.Ext(name) != "" {
+				ctx.Header("Content-Type", util.MimeType(name))
+			}
+
+		default:
+			ctx.Header("Allow", webdavAllow)
+			ctx.String(http.StatusMethodNotAllowed, "WebDAV share is read-only")
+			return
+		}
+
+		handler := &webdav.Handler{
+			Prefix:     webdavPrefix,
+			FileSystem: bittorrent.NewWebDAVFS(s, ctx.Request.Method),
+			LockSystem: webdavLocks,
+			Logger: func(r *http.Request, err error) {
+				if err != nil {
+					log.Debugf("WebDAV %s %s failed: %s", r.Method, r.URL.Path, err)
+				}
+			},
+		}
+		handler.ServeHTTP(ctx.Writer, ctx.Request)
+	}
+}
@@ -0,0 +1,171 @@
+package bittorrent
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/goccy/go-json"
+
+	"github.com/elgatito/elementum/config"
+	"github.com/elgatito/elementum/database"
+	"github.com/elgatito/elementum/util"
+)
+
+const categoriesFile = "categories.json"
+
+// Category is a label for torrents with own download and completed-move paths.
+// Empty paths mean global settings are used.
+type Category struct {
+	Name          string               `json:"name"`
+	DownloadPath  string               `json:"download_path"`
+	CompletedPath string               `json:"completed_path"`
+	SeedPolicy    *database.SeedPolicy `json:"seed_policy,omitempty"`
+}
+
+// LoadCategories reads categories from the profile folder
+func LoadCategories() (map[string]*Category, error) {
+	filePath := filepath.Join(config.Get().ProfilePath, categoriesFile)
+	b, err := os.ReadFile(filePath)
+	if err != nil {
+		return nil, err
+	}
+
+	categories := map[string]*Category{}
+	if err := json.Unmarshal(b, &categories); err != nil {
+		return nil, fmt.Errorf("Could not parse %s: %s", filePath, err)
+	}
+
+	for name, c := range categories {
+		if c == nil {
+			delete(categories, name)
+			continue
+		}
+		c.Name = name
+		if c.DownloadPath != "" {
+			if err := util.IsWritablePath(c.DownloadPath); err != nil {
+				return nil, fmt.Errorf("Wrong download path for category %s: %s", name, err)
+			}
+		}
+	}
+
+	return categories, nil
+}
+
+// loadCategories reloads categories file
+func (s *Service) loadCategories() {
+	s.muCategories.Lock()
+	defer s.muCategories.Unlock()
+
+	s.categories = map[string]*Category{}
+
+	categories, err := LoadCategories()
+	if err != nil {
+		if !os.IsNotExist(err) {
+			log.Warningf("Could not load categories: %s", err)
+		}
+		return
+	}
+
+	s.categories = categories
+	log.Infof("Loaded %d torrent categories", len(categories))
+}
+
+// GetCategories returns sorted list of defined categories
+func (s *Service) GetCategories() []*Category {
+	s.muCategories.Lock()
+	defer s.muCategories.Unlock()
+
+	ret := make([]*Category, 0, len(s.categories))
+	for _, c := range s.categories {
+		ret = append(ret, c)
+	}
+	sort.Slice(ret, func(i, j int) bool {
+		return strings.ToLower(ret[i].Name) < strings.ToLower(ret[j].Name)
+	})
+
+	return ret
+}
+
+// GetCategory returns category by name, or nil if it is not defined
+func (s *Service) GetCategory(name string) *Category {
+	if name == "" {
+		return nil
+	}
+
+	s.muCategories.Lock()
+	defer s.muCategories.Unlock()
+
+	return s.categories[name]
+}
+
+// GetCategorySavePath returns download path for the category, or global download path
+func (s *Service) GetCategorySavePath(name string) string {
+	if c := s.GetCategory(name); c != nil && c.DownloadPath != "" {
+		return c.DownloadPath
+	}
+
+	return s.config.DownloadPath
+}
+
+// getSavePaths returns global download path and download paths of all categories
+func (s *Service) getSavePaths() []string {
+	ret := []string{s.config.DownloadPath}
+	for _, c := range s.GetCategories() {
+		if c.DownloadPath != "" && !util.StringSliceContains(ret, c.DownloadPath) {
+			ret = append(ret, c.DownloadPath)
+		}
+	}
+
+	return ret
+}
+
+// GetCategory returns torrent category name
+func (t *Torrent) GetCategory() string {
+	if t.DBItem != nil && t.DBItem.Category != "" {
+		return t.DBItem.Category
+	}
+
+	return t.category
+}
+
+// SetCategory saves torrent category and moves downloaded files if download path has changed
+func (t *Torrent) SetCategory(name string) error {
+	if name != "" && t.Service.GetCategory(name) == nil {
+		return fmt.Errorf("Unknown category: %s", name)
+	}
+
+	if err := database.GetStorm().UpdateBTItemCategory(t.infoHash, name); err != nil {
+		return err
+	}
+	t.category = name
+	t.FetchDBItem()
+
+	if t.IsMemoryStorage() {
+		return nil
+	}
+
+	if savePath := t.Service.GetCategorySavePath(name); savePath != t.GetSavePath() {
+		log.Infof("Moving torrent %s storage from %s to %s", t.Name(), t.GetSavePath(), savePath)
+		t.th.MoveStorage(savePath)
+		t.savePath = savePath
+	}
+
+	return nil
+}
+
+// GetSavePath returns folder, where torrent files are stored
+func (t *Torrent) GetSavePath() string {
+	if t.savePath != "" {
+		return t.savePath
+	}
+
+	return t.Service.config.DownloadPath
+}
+
+// partsFilePath returns libtorrent parts file, it follows the storage when category is changed
+func (t *Torrent) partsFilePath() string {
+	return filepath.Join(t.GetSavePath(), fmt.Sprintf(".%s.parts", t.infoHash))
+}
@@ -0,0 +1,229 @@
+package bittorrent
+
+import (
+	"errors"
+	"fmt"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/dustin/go-humanize"
+
+	"github.com/elgatito/elementum/database"
+	"github.com/elgatito/elementum/library/uid"
+)
+
+const (
+	// CleanupReasonWatched means torrent was watched more than configured days ago
+	CleanupReasonWatched = "watched"
+	// CleanupReasonSize means torrent is evicted to keep downloads under configured size
+	CleanupReasonSize = "size"
+)
+
+// CleanupItem is a torrent, that is removed by cleanup policy
+type CleanupItem struct {
+	InfoHash  string    `json:"infoHash"`
+	Name      string    `json:"name"`
+	Size      int64     `json:"size"`
+	WatchedAt time.Time `json:"watched_at"`
+	Reason    string    `json:"reason"`
+}
+
+// CleanupReport is the result of cleanup policy run
+type CleanupReport struct {
+	DryRun      bool           `json:"dry_run"`
+	WatchedDays int            `json:"watched_days"`
+	MaxSize     int64          `json:"max_size"`
+	TotalSize   int64          `json:"total_size"`
+	Freed       int64          `json:"freed"`
+	Removed     []*CleanupItem `json:"removed"`
+	Errors      []string       `json:"errors"`
+}
+
+// cleanupCandidate is a completed and watched torrent, that can be removed
+type cleanupCandidate struct {
+	t              *Torrent
+	size           int64
+	watchedAt      time.Time
+	inDownloadPath bool
+}
+
+func (s *Service) watchCleanup() {
+	closing := s.Closer.C()
+	ticker := time.NewTicker(1 * time.Hour)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-closing:
+			return
+
+		case <-ticker.C:
+			if !s.config.CleanupEnabled {
+				continue
+			}
+
+			report := s.Cleanup(false)
+			if len(report.Removed) > 0 {
+				log.Infof("Cleanup policy removed %d torrents, freed %s", len(report.Removed), humanize.Bytes(uint64(report.Freed)))
+			}
+		}
+	}
+}
+
+// Cleanup removes completed and watched torrents, watched more than configured days ago,
+// and least recently watched torrents, while downloads in download path take more than configured size.
+// Torrents, stored in category paths outside of download path, do not count to the size.
+// Pinned, played and not completed torrents are never removed. Dry run only returns the report.
+func (s *Service) Cleanup(dryRun bool) *CleanupReport {
+	s.muCleanup.Lock()
+	defer s.muCleanup.Unlock()
+
+	report := &CleanupReport{
+		DryRun:      dryRun,
+		WatchedDays: s.config.CleanupWatchedDays,
+		MaxSize:     s.config.CleanupMaxSize,
+		Removed:     []*CleanupItem{},
+		Errors:      []string{},
+	}
+
+	candidates := []*cleanupCandidate{}
+	for _, t := range s.GetTorrents() {
+		if t == nil || t.Closer.IsSet() || t.IsPreview || t.IsMemoryStorage() {
+			continue
+		}
+
+		status := t.GetLastStatus(false)
+		if status == nil || status.Swigcptr() == 0 {
+			continue
+		}
+		size := status.GetTotalDone()
+		inDownloadPath := t.isInDownloadPath()
+		if inDownloadPath {
+			report.TotalSize += size
+		}
+
+		if t.PlayerAttached > 0 || t.IsMoveInProgress || t.GetProgress() < 100 {
+			continue
+		}
+
+		item := t.FetchDBItem()
+		if item != nil && item.Pinned {
+			continue
+		}
+
+		watchedAt, ok := t.cleanupWatchedAt(item, dryRun)
+		if !ok {
+			continue
+		}
+
+		candidates = append(candidates, &cleanupCandidate{t: t, size: size, watchedAt: watchedAt, inDownloadPath: inDownloadPath})
+	}
+
+	// Least recently watched first
+	sort.SliceStable(candidates, func(i, j int) bool {
+		return candidates[i].watchedAt.Before(candidates[j].watchedAt)
+	})
+
+	totalSize := report.TotalSize
+	for _, c := range candidates {
+		reason := ""
+		if report.WatchedDays > 0 && time.Since(c.watchedAt) >= time.Duration(report.WatchedDays)*24*time.Hour {
+			reason = CleanupReasonWatched
+		} else if report.MaxSize > 0 && totalSize > report.MaxSize && c.inDownloadPath {
+			reason = CleanupReasonSize
+		} else {
+			continue
+		}
+
+		if !dryRun {
+			log.Infof("Cleanup policy removes %s, reason: %s", c.t.Name(), reason)
+			if !s.RemoveTorrent(nil, c.t, RemoveOptions{ForceDrop: true, ForceDelete: true}) {
+				report.Errors = append(report.Errors, fmt.Sprintf("Unable to remove %s", c.t.Name()))
+				continue
+			}
+		}
+
+		if c.inDownloadPath {
+			totalSize -= c.size
+		}
+		report.Freed += c.size
+		report.Removed = append(report.Removed, &CleanupItem{
+			InfoHash:  c.t.InfoHash(),
+			Name:      c.t.Name(),
+			Size:      c.size,
+			WatchedAt: c.watchedAt,
+			Reason:    reason,
+		})
+	}
+
+	return report
+}
+
+// isInDownloadPath checks whether torrent files are stored inside of global download path
+func (t *Torrent) isInDownloadPath() bool {
+	rel, err := filepath.Rel(t.Service.config.DownloadPath, t.GetSavePath())
+	return err == nil && rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator))
+}
+
+// cleanupWatchedAt checks whether torrent is watched, according to Kodi library playcount,
+// or to watched state of all chosen files, and returns the time, when it was watched.
+func (t *Torrent) cleanupWatchedAt(item *database.BTItem, dryRun bool) (time.Time, bool) {
+	watched := false
+	if item != nil && item.Type == movieType {
+		if m, err := uid.GetMovieByTMDB(item.ID); err == nil && m != nil {
+			watched = m.IsWatched()
+		}
+	} else if item != nil && item.Type == episodeType {
+		if show, err := uid.GetShowByTMDB(item.ShowID); err == nil && show != nil {
+			if e := show.GetEpisode(item.Season, item.Episode); e != nil {
+				watched = e.IsWatched()
+			}
+		}
+	}
+
+	if !watched {
+		files := t.ChosenFiles
+		if len(files) == 0 {
+			return time.Time{}, false
+		}
+		for _, f := range files {
+			if !IsWatchedFile(f.Path, f.Size) {
+				return time.Time{}, false
+			}
+		}
+	}
+
+	// Player saves the time of last watching
+	if item != nil && !item.WatchedAt.IsZero() {
+		return item.WatchedAt, true
+	}
+
+	// Watched outside of the player, so counting days from the moment it was noticed
+	now := time.Now()
+	if !dryRun && !database.WritesSuspended() {
+		database.GetStorm().UpdateBTItemWatched(t.InfoHash(), now)
+		t.FetchDBItem()
+	}
+	return now, true
+}
+
+// SetPinned protects torrent from removal by cleanup policy
+func (t *Torrent) SetPinned(pinned bool) error {
+	if t.IsPreview {
+		return errors.New("Preview torrents can not be pinned")
+	}
+
+	if err := database.GetStorm().UpdateBTItemPinned(t.infoHash, pinned); err != nil {
+		return err
+	}
+	t.FetchDBItem()
+
+	return nil
+}
+
+// IsPinned checks whether torrent is protected from removal by cleanup policy
+func (t *Torrent) IsPinned() bool {
+	return t.DBItem != nil && t.DBItem.Pinned
+}
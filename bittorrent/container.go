@@ -0,0 +1,740 @@
+package bittorrent
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"math/bits"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Media container index parsing, to know exactly which parts of the file
+// player reads to open it, and to map file offsets to playback time.
+
+const (
+	containerMP4 = "mp4"
+	containerMKV = "mkv"
+
+	maxContainerIndexSize = 64 * 1024 * 1024
+	maxMP4Boxes           = 64
+)
+
+// Matroska element IDs
+const (
+	mkvEBML               = 0x1A45DFA3
+	mkvSegment            = 0x18538067
+	mkvSeekHead           = 0x114D9B74
+	mkvSeek               = 0x4DBB
+	mkvSeekID             = 0x53AB
+	mkvSeekPosition       = 0x53AC
+	mkvInfo               = 0x1549A966
+	mkvTimestampScale     = 0x2AD7B1
+	mkvDuration           = 0x4489
+	mkvTracks             = 0x1654AE6B
+	mkvCluster            = 0x1F43B675
+	mkvCues               = 0x1C53BB6B
+	mkvCuePoint           = 0xBB
+	mkvCueTime            = 0xB3
+	mkvCueTrackPositions  = 0xB7
+	mkvCueClusterPosition = 0xF1
+	mkvChapters           = 0x1043A770
+	mkvTags               = 0x1254C367
+	mkvAttachments        = 0x1941A469
+)
+
+// mkvIndexElements are top level elements, that demuxer reads when file is opened
+var mkvIndexElements = map[uint64]bool{
+	mkvSeekHead:    true,
+	mkvInfo:        true,
+	mkvTracks:      true,
+	mkvCues:        true,
+	mkvChapters:    true,
+	mkvTags:        true,
+	mkvAttachments: true,
+}
+
+var (
+	errContainerNotSupported = errors.New("Container is not supported")
+	errInvalidMP4            = errors.New("Invalid MP4 box")
+	errInvalidMKV            = errors.New("Invalid Matroska element")
+)
+
+// missingRangeError means the range of the file is not downloaded yet
+type missingRangeError struct {
+	Offset int64
+	Length int64
+}
+
+func (e *missingRangeError) Error() string {
+	return fmt.Sprintf("Range %d-%d is not downloaded", e.Offset, e.Offset+e.Length)
+}
+
+// ByteRange is [Start, End) range of file bytes
+type ByteRange struct {
+	Start int64
+	End   int64
+}
+
+// ContainerIndex is location of media container index and seek points of the file
+type ContainerIndex struct {
+	Format   string
+	Size     int64
+	Duration time.Duration
+	Ranges   []ByteRange
+
+	// Seek points of the main track, sorted by offset
+	points []indexPoint
+}
+
+type indexPoint struct {
+	offset int64
+	time   time.Duration
+}
+
+// isContainerSupported checks whether index of the file can be parsed
+func isContainerSupported(name string) bool {
+	switch strings.ToLower(filepath.Ext(name)) {
+	case ".mp4", ".m4v", ".mov", ".mkv", ".mk3d", ".webm":
+		return true
+	}
+	return false
+}
+
+// parseContainerIndex reads container index, returns *missingRangeError,
+// if it needs a part of the file, that can not be read yet.
+func parseContainerIndex(r io.ReaderAt, name string, size int64) (*ContainerIndex, error) {
+	switch strings.ToLower(filepath.Ext(name)) {
+	case ".mp4", ".m4v", ".mov":
+		return parseMP4(r, size)
+	case ".mkv", ".mk3d", ".webm":
+		return parseMKV(r, size)
+	}
+	return nil, errContainerNotSupported
+}
+
+// Bitrate returns average bytes per second
+func (ci *ContainerIndex) Bitrate() int64 {
+	if ci.Duration <= 0 {
+		return 0
+	}
+	return int64(float64(ci.Size) / ci.Duration.Seconds())
+}
+
+// BitrateAt returns bytes per second for the window of playback, starting at the offset,
+// so that variable bitrate is taken into account.
+func (ci *ContainerIndex) BitrateAt(offset int64, window time.Duration) int64 {
+	if len(ci.points) < 2 || window <= 0 {
+		return ci.Bitrate()
+	}
+
+	end := ci.OffsetAt(ci.TimeAt(offset) + window)
+	if end <= offset {
+		return ci.Bitrate()
+	}
+	return int64(float64(end-offset) / window.Seconds())
+}
+
+// TimeAt returns playback time for the file offset
+func (ci *ContainerIndex) TimeAt(offset int64) time.Duration {
+	if len(ci.points) == 0 {
+		if ci.Size <= 0 {
+			return 0
+		}
+		return time.Duration(float64(ci.Duration) * float64(offset) / float64(ci.Size))
+	}
+
+	i := sort.Search(len(ci.points), func(i int) bool { return ci.points[i].offset > offset }) - 1
+	if i < 0 {
+		return 0
+	}
+
+	from := ci.points[i]
+	to := indexPoint{offset: ci.Size, time: ci.Duration}
+	if i+1 < len(ci.points) {
+		to = ci.points[i+1]
+	}
+	if to.offset <= from.offset || to.time <= from.time {
+		return from.time
+	}
+	return from.time + time.Duration(float64(to.time-from.time)*float64(offset-from.offset)/float64(to.offset-from.offset))
+}
+
+// OffsetAt returns file offset for the playback time
+func (ci *ContainerIndex) OffsetAt(t time.Duration) int64 {
+	if len(ci.points) == 0 {
+		if ci.Duration <= 0 {
+			return 0
+		}
+		return int64(float64(ci.Size) * float64(t) / float64(ci.Duration))
+	}
+
+	i := sort.Search(len(ci.points), func(i int) bool { return ci.points[i].time > t }) - 1
+	if i < 0 {
+		return 0
+	}
+
+	from := ci.points[i]
+	to := indexPoint{offset: ci.Size, time: ci.Duration}
+	if i+1 < len(ci.points) {
+		to = ci.points[i+1]
+	}
+	if to.offset <= from.offset || to.time <= from.time {
+		return from.offset
+	}
+	return from.offset + int64(float64(to.offset-from.offset)*float64(t-from.time)/float64(to.time-from.time))
+}
+
+func readAtLeast(r io.ReaderAt, off, length int64) ([]byte, error) {
+	buf := make([]byte, length)
+	n, err := r.ReadAt(buf, off)
+	if int64(n) == length {
+		return buf, nil
+	}
+	if err == nil || err == io.EOF {
+		err = io.ErrUnexpectedEOF
+	}
+	return nil, err
+}
+
+// parseMP4 walks top level boxes till moov, usually it is either right after ftyp,
+// or after mdat in the end of the file.
+func parseMP4(r io.ReaderAt, size int64) (*ContainerIndex, error) {
+	off := int64(0)
+	for i := 0; i < maxMP4Boxes && off+8 <= size; i++ {
+		hdr, err := readAtLeast(r, off, min64(16, size-off))
+		if err != nil {
+			return nil, err
+		}
+
+		boxSize := int64(binary.BigEndian.Uint32(hdr[0:4]))
+		boxType := string(hdr[4:8])
+		hdrSize := int64(8)
+		if boxSize == 1 {
+			if len(hdr) < 16 {
+				return nil, errInvalidMP4
+			}
+			boxSize = int64(binary.BigEndian.Uint64(hdr[8:16]))
+			hdrSize = 16
+		} else if boxSize == 0 {
+			boxSize = size - off
+		}
+		if boxSize < hdrSize || boxSize > size-off {
+			return nil, errInvalidMP4
+		}
+
+		switch boxType {
+		case "moov":
+			if boxSize > maxContainerIndexSize {
+				return nil, fmt.Errorf("MP4 moov box is too big: %d", boxSize)
+			}
+
+			data, err := readAtLeast(r, off+hdrSize, boxSize-hdrSize)
+			if err != nil {
+				return nil, err
+			}
+
+			ci := &ContainerIndex{
+				Format: containerMP4,
+				Size:   size,
+				Ranges: []ByteRange{{Start: off, End: off + boxSize}},
+			}
+			if err := ci.parseMoov(data); err != nil {
+				return nil, err
+			}
+			return ci, nil
+
+		case "moof":
+			return nil, errors.New("Fragmented MP4 has no moov box before fragments")
+		}
+
+		off += boxSize
+	}
+
+	return nil, errors.New("MP4 moov box not found")
+}
+
+// mp4Boxes calls fn for each child box
+func mp4Boxes(data []byte, fn func(boxType string, payload []byte) error) error {
+	for len(data) >= 8 {
+		size := uint64(binary.BigEndian.Uint32(data[0:4]))
+		boxType := string(data[4:8])
+		hdrSize := uint64(8)
+		if size == 1 {
+			if len(data) < 16 {
+				return errInvalidMP4
+			}
+			size = binary.BigEndian.Uint64(data[8:16])
+			hdrSize = 16
+		} else if size == 0 {
+			size = uint64(len(data))
+		}
+		if size < hdrSize || size > uint64(len(data)) {
+			return errInvalidMP4
+		}
+
+		if err := fn(boxType, data[hdrSize:size]); err != nil {
+			return err
+		}
+		data = data[size:]
+	}
+	return nil
+}
+
+// mp4Duration reads timescale and duration of mvhd and mdhd boxes
+func mp4Duration(payload []byte) (timescale uint32, duration uint64) {
+	if len(payload) < 4 {
+		return
+	}
+	if payload[0] == 1 {
+		if len(payload) < 32 {
+			return
+		}
+		return binary.BigEndian.Uint32(payload[20:24]), binary.BigEndian.Uint64(payload[24:32])
+	}
+	if len(payload) < 20 {
+		return
+	}
+	return binary.BigEndian.Uint32(payload[12:16]), uint64(binary.BigEndian.Uint32(payload[16:20]))
+}
+
+func (ci *ContainerIndex) parseMoov(moov []byte) error {
+	var video, audio *mp4Track
+	err := mp4Boxes(moov, func(boxType string, payload []byte) error {
+		switch boxType {
+		case "mvhd":
+			if timescale, duration := mp4Duration(payload); timescale > 0 {
+				ci.Duration = time.Duration(float64(duration) / float64(timescale) * float64(time.Second))
+			}
+		case "trak":
+			track := parseMP4Track(payload)
+			if track == nil {
+				return nil
+			}
+			if track.handler == "vide" && video == nil {
+				video = track
+			} else if track.handler == "soun" && audio == nil {
+				audio = track
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	if video != nil {
+		ci.points = video.indexPoints()
+	} else if audio != nil {
+		ci.points = audio.indexPoints()
+	}
+	return nil
+}
+
+// mp4Track is sample table of a track, needed to find chunks times
+type mp4Track struct {
+	handler   string
+	timescale uint32
+	stts      []byte
+	stsc      []byte
+	stco      []byte
+	co64      bool
+}
+
+func parseMP4Track(trak []byte) *mp4Track {
+	track := &mp4Track{}
+
+	var walk func(data []byte) error
+	walk = func(data []byte) error {
+		return mp4Boxes(data, func(boxType string, payload []byte) error {
+			switch boxType {
+			case "mdia", "minf", "stbl":
+				return walk(payload)
+			case "mdhd":
+				track.timescale, _ = mp4Duration(payload)
+			case "hdlr":
+				if len(payload) >= 12 {
+					track.handler = string(payload[8:12])
+				}
+			case "stts":
+				track.stts = payload
+			case "stsc":
+				track.stsc = payload
+			case "stco":
+				track.stco = payload
+			case "co64":
+				track.stco = payload
+				track.co64 = true
+			}
+			return nil
+		})
+	}
+
+	if err := walk(trak); err != nil {
+		return nil
+	}
+	return track
+}
+
+// indexPoints returns offsets of track chunks with time of their first samples
+func (track *mp4Track) indexPoints() []indexPoint {
+	if track.timescale == 0 || len(track.stts) < 8 || len(track.stsc) < 8 || len(track.stco) < 8 {
+		return nil
+	}
+
+	entrySize := 4
+	if track.co64 {
+		entrySize = 8
+	}
+	chunks := min64(int64(binary.BigEndian.Uint32(track.stco[4:8])), int64((len(track.stco)-8)/entrySize))
+	stscCount := min64(int64(binary.BigEndian.Uint32(track.stsc[4:8])), int64((len(track.stsc)-8)/12))
+	sttsCount := min64(int64(binary.BigEndian.Uint32(track.stts[4:8])), int64((len(track.stts)-8)/8))
+	if stscCount == 0 || sttsCount == 0 {
+		return nil
+	}
+
+	points := make([]indexPoint, 0, chunks)
+
+	var sampleTime, sttsLeft, sttsDelta uint64
+	sttsIndex := int64(0)
+	stscIndex := int64(0)
+	for chunk := int64(0); chunk < chunks; chunk++ {
+		// First chunk of stsc entry is 1-based
+		for stscIndex+1 < stscCount && int64(binary.BigEndian.Uint32(track.stsc[8+(stscIndex+1)*12:])) <= chunk+1 {
+			stscIndex++
+		}
+		samples := uint64(binary.BigEndian.Uint32(track.stsc[8+stscIndex*12+4:]))
+
+		var offset int64
+		if track.co64 {
+			offset = int64(binary.BigEndian.Uint64(track.stco[8+chunk*8:]))
+		} else {
+			offset = int64(binary.BigEndian.Uint32(track.stco[8+chunk*4:]))
+		}
+		points = append(points, indexPoint{
+			offset: offset,
+			time:   time.Duration(float64(sampleTime) / float64(track.timescale) * float64(time.Second)),
+		})
+
+		for samples > 0 {
+			if sttsLeft == 0 {
+				if sttsIndex >= sttsCount {
+					break
+				}
+				sttsLeft = uint64(binary.BigEndian.Uint32(track.stts[8+sttsIndex*8:]))
+				sttsDelta = uint64(binary.BigEndian.Uint32(track.stts[8+sttsIndex*8+4:]))
+				sttsIndex++
+				continue
+			}
+
+			take := samples
+			if sttsLeft < take {
+				take = sttsLeft
+			}
+			sampleTime += take * sttsDelta
+			sttsLeft -= take
+			samples -= take
+		}
+	}
+
+	sort.SliceStable(points, func(i, j int) bool {
+		return points[i].offset < points[j].offset
+	})
+	return points
+}
+
+// ebmlVint reads variable size integer, marker bit is kept for element IDs
+func ebmlVint(b []byte, keepMarker bool) (val uint64, n int, err error) {
+	if len(b) == 0 || b[0] == 0 {
+		return 0, 0, errInvalidMKV
+	}
+
+	n = bits.LeadingZeros8(b[0]) + 1
+	if n > len(b) {
+		return 0, 0, errInvalidMKV
+	}
+
+	val = uint64(b[0])
+	if !keepMarker {
+		val &= uint64(0xFF >> n)
+	}
+	for i := 1; i < n; i++ {
+		val = val<<8 | uint64(b[i])
+	}
+	return val, n, nil
+}
+
+// ebmlHeader parses element ID and data size, unknown size is returned as -1
+func ebmlHeader(b []byte) (id uint64, dataSize int64, n int, err error) {
+	id, idLen, err := ebmlVint(b, true)
+	if err != nil {
+		return
+	}
+	size, sizeLen, err := ebmlVint(b[idLen:], false)
+	if err != nil {
+		return
+	}
+
+	dataSize = int64(size)
+	if size == (uint64(1)<<(7*uint(sizeLen)))-1 {
+		dataSize = -1
+	}
+	return id, dataSize, idLen + sizeLen, nil
+}
+
+// readEBMLHeader reads header of the element at the file offset
+func readEBMLHeader(r io.ReaderAt, off, size int64) (id uint64, dataOffset, dataSize int64, err error) {
+	if off >= size {
+		return 0, 0, 0, io.ErrUnexpectedEOF
+	}
+
+	b, err := readAtLeast(r, off, min64(12, size-off))
+	if err != nil {
+		return
+	}
+
+	id, dataSize, n, err := ebmlHeader(b)
+	if err != nil {
+		return
+	}
+	return id, off + int64(n), dataSize, nil
+}
+
+// ebmlElements calls fn for each child element
+func ebmlElements(data []byte, fn func(id uint64, payload []byte) error) error {
+	for len(data) > 0 {
+		id, size, n, err := ebmlHeader(data)
+		if err != nil {
+			return err
+		}
+		if size < 0 || int64(len(data)-n) < size {
+			return errInvalidMKV
+		}
+
+		if err := fn(id, data[n:int64(n)+size]); err != nil {
+			return err
+		}
+		data = data[int64(n)+size:]
+	}
+	return nil
+}
+
+func ebmlUint(b []byte) (ret uint64) {
+	for _, v := range b {
+		ret = ret<<8 | uint64(v)
+	}
+	return
+}
+
+func ebmlFloat(b []byte) float64 {
+	switch len(b) {
+	case 4:
+		return float64(math.Float32frombits(binary.BigEndian.Uint32(b)))
+	case 8:
+		return math.Float64frombits(binary.BigEndian.Uint64(b))
+	}
+	return 0
+}
+
+// mkvIndex collects positions of top level elements and parsed values
+type mkvIndex struct {
+	ci             *ContainerIndex
+	segmentStart   int64
+	positions      []int64
+	visited        map[int64]bool
+	timestampScale uint64
+	duration       float64
+	cues           []byte
+}
+
+// parseMKV reads top level elements of the segment till first cluster,
+// then elements, referenced by SeekHead, which are usually in the end of the file.
+func parseMKV(r io.ReaderAt, size int64) (*ContainerIndex, error) {
+	id, dataOffset, dataSize, err := readEBMLHeader(r, 0, size)
+	if err != nil {
+		return nil, err
+	}
+	if id != mkvEBML || dataSize < 0 {
+		return nil, errInvalidMKV
+	}
+
+	id, segmentStart, segmentSize, err := readEBMLHeader(r, dataOffset+dataSize, size)
+	if err != nil {
+		return nil, err
+	}
+	if id != mkvSegment {
+		return nil, errInvalidMKV
+	}
+	segmentEnd := size
+	if segmentSize >= 0 && segmentStart+segmentSize < size {
+		segmentEnd = segmentStart + segmentSize
+	}
+
+	idx := &mkvIndex{
+		ci:             &ContainerIndex{Format: containerMKV, Size: size},
+		segmentStart:   segmentStart,
+		visited:        map[int64]bool{},
+		timestampScale: 1000000,
+	}
+
+	for off := segmentStart; off < segmentEnd; {
+		id, dataOffset, dataSize, err := readEBMLHeader(r, off, size)
+		if err != nil {
+			return nil, err
+		}
+		if id == mkvCluster || dataSize < 0 {
+			break
+		}
+
+		if err := idx.element(r, off, id, dataOffset, dataSize); err != nil {
+			return nil, err
+		}
+		off = dataOffset + dataSize
+	}
+
+	// SeekHead can reference another SeekHead, so positions grow while reading
+	for i := 0; i < len(idx.positions); i++ {
+		off := idx.positions[i]
+		if idx.visited[off] || off < 0 || off >= size {
+			continue
+		}
+
+		id, dataOffset, dataSize, err := readEBMLHeader(r, off, size)
+		if err != nil {
+			return nil, err
+		}
+		if dataSize < 0 || !mkvIndexElements[id] {
+			continue
+		}
+		if err := idx.element(r, off, id, dataOffset, dataSize); err != nil {
+			return nil, err
+		}
+	}
+
+	ci := idx.ci
+	ci.Duration = time.Duration(idx.duration * float64(idx.timestampScale))
+	if idx.cues != nil {
+		ci.points = idx.cuePoints()
+	}
+	sort.Slice(ci.Ranges, func(i, j int) bool {
+		return ci.Ranges[i].Start < ci.Ranges[j].Start
+	})
+
+	return ci, nil
+}
+
+// element adds top level element to index ranges and reads the ones, needed for the index
+func (idx *mkvIndex) element(r io.ReaderAt, off int64, id uint64, dataOffset, dataSize int64) error {
+	idx.visited[off] = true
+	if !mkvIndexElements[id] {
+		return nil
+	}
+	idx.ci.Ranges = append(idx.ci.Ranges, ByteRange{Start: off, End: dataOffset + dataSize})
+
+	if (id != mkvSeekHead && id != mkvInfo && id != mkvCues) || dataSize > maxContainerIndexSize {
+		return nil
+	}
+
+	data, err := readAtLeast(r, dataOffset, dataSize)
+	if err != nil {
+		return err
+	}
+
+	switch id {
+	case mkvSeekHead:
+		return ebmlElements(data, func(id uint64, payload []byte) error {
+			if id != mkvSeek {
+				return nil
+			}
+
+			var seekID, seekPosition uint64
+			hasPosition := false
+			if err := ebmlElements(payload, func(id uint64, payload []byte) error {
+				switch id {
+				case mkvSeekID:
+					seekID = ebmlUint(payload)
+				case mkvSeekPosition:
+					seekPosition = ebmlUint(payload)
+					hasPosition = true
+				}
+				return nil
+			}); err != nil {
+				return err
+			}
+
+			if hasPosition && mkvIndexElements[seekID] {
+				idx.positions = append(idx.positions, idx.segmentStart+int64(seekPosition))
+			}
+			return nil
+		})
+
+	case mkvInfo:
+		return ebmlElements(data, func(id uint64, payload []byte) error {
+			switch id {
+			case mkvTimestampScale:
+				if scale := ebmlUint(payload); scale > 0 {
+					idx.timestampScale = scale
+				}
+			case mkvDuration:
+				idx.duration = ebmlFloat(payload)
+			}
+			return nil
+		})
+
+	case mkvCues:
+		idx.cues = data
+	}
+
+	return nil
+}
+
+// cuePoints returns cluster positions with their times, cues have a point for each keyframe
+func (idx *mkvIndex) cuePoints() []indexPoint {
+	points := []indexPoint{}
+	seen := map[int64]bool{}
+
+	ebmlElements(idx.cues, func(id uint64, payload []byte) error {
+		if id != mkvCuePoint {
+			return nil
+		}
+
+		var cueTime uint64
+		position := int64(-1)
+		ebmlElements(payload, func(id uint64, payload []byte) error {
+			switch id {
+			case mkvCueTime:
+				cueTime = ebmlUint(payload)
+			case mkvCueTrackPositions:
+				ebmlElements(payload, func(id uint64, payload []byte) error {
+					if id == mkvCueClusterPosition && position < 0 {
+						position = idx.segmentStart + int64(ebmlUint(payload))
+					}
+					return nil
+				})
+			}
+			return nil
+		})
+
+		if position >= 0 && !seen[position] {
+			seen[position] = true
+			points = append(points, indexPoint{offset: position, time: time.Duration(cueTime * idx.timestampScale)})
+		}
+		return nil
+	})
+
+	sort.SliceStable(points, func(i, j int) bool {
+		return points[i].offset < points[j].offset
+	})
+	return points
+}
+
+func min64(a, b int64) int64 {
+	if a < b {
+		return a
+	}
+	return b
+}
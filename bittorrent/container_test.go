@@ -0,0 +1,434 @@
+package bittorrent
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"math"
+	"testing"
+	"time"
+)
+
+const (
+	testChunks    = 10
+	testChunkSize = 1000
+)
+
+// partialReader returns missingRangeError for bytes after the limit, like pieceReader does
+type partialReader struct {
+	data  []byte
+	limit int64
+}
+
+func (pr *partialReader) ReadAt(p []byte, off int64) (int, error) {
+	if off+int64(len(p)) > pr.limit {
+		return 0, &missingRangeError{Offset: off, Length: int64(len(p))}
+	}
+	return bytes.NewReader(pr.data).ReadAt(p, off)
+}
+
+func mp4Box(boxType string, payload ...[]byte) []byte {
+	data := bytes.Join(payload, nil)
+	b := make([]byte, 8, 8+len(data))
+	binary.BigEndian.PutUint32(b, uint32(8+len(data)))
+	copy(b[4:], boxType)
+	return append(b, data...)
+}
+
+func be32(values ...uint32) []byte {
+	b := make([]byte, 4*len(values))
+	for i, v := range values {
+		binary.BigEndian.PutUint32(b[i*4:], v)
+	}
+	return b
+}
+
+// testMoov returns moov box with one video track, that has a chunk with one sample per second
+func testMoov(chunkOffsets []uint32) []byte {
+	stco := be32(0, uint32(len(chunkOffsets)))
+	stco = append(stco, be32(chunkOffsets...)...)
+
+	return mp4Box("moov",
+		mp4Box("mvhd", be32(0, 0, 0, 1000, testChunks*1000)),
+		mp4Box("trak",
+			mp4Box("mdia",
+				mp4Box("mdhd", be32(0, 0, 0, 1000, testChunks*1000)),
+				mp4Box("hdlr", be32(0, 0), []byte("vide")),
+				mp4Box("minf",
+					mp4Box("stbl",
+						mp4Box("stts", be32(0, 1, testChunks, 1000)),
+						mp4Box("stsc", be32(0, 1, 1, 1, 1)),
+						mp4Box("stco", stco),
+					),
+				),
+			),
+		),
+	)
+}
+
+// testMP4 returns file with moov either before or after mdat, and offsets of chunks
+func testMP4(moovFirst bool) ([]byte, []int64) {
+	ftyp := mp4Box("ftyp", []byte("isom"), be32(0))
+	mdat := mp4Box("mdat", make([]byte, testChunks*testChunkSize))
+	moovSize := len(testMoov(make([]uint32, testChunks)))
+
+	mdatStart := len(ftyp)
+	if moovFirst {
+		mdatStart += moovSize
+	}
+
+	offsets := make([]uint32, testChunks)
+	ret := make([]int64, testChunks)
+	for i := range offsets {
+		offsets[i] = uint32(mdatStart + 8 + i*testChunkSize)
+		ret[i] = int64(offsets[i])
+	}
+
+	if moovFirst {
+		return bytes.Join([][]byte{ftyp, testMoov(offsets), mdat}, nil), ret
+	}
+	return bytes.Join([][]byte{ftyp, mdat, testMoov(offsets)}, nil), ret
+}
+
+func ebmlID(id uint64) []byte {
+	b := make([]byte, 8)
+	binary.BigEndian.PutUint64(b, id)
+	for len(b) > 1 && b[0] == 0 {
+		b = b[1:]
+	}
+	return b
+}
+
+// mkvElement uses 8 bytes size, so element size does not depend on values
+func mkvElement(id uint64, payload ...[]byte) []byte {
+	data := bytes.Join(payload, nil)
+	size := make([]byte, 8)
+	binary.BigEndian.PutUint64(size, uint64(len(data)))
+	size[0] = 0x01
+	return bytes.Join([][]byte{ebmlID(id), size, data}, nil)
+}
+
+func be64(v uint64) []byte {
+	b := make([]byte, 8)
+	binary.BigEndian.PutUint64(b, v)
+	return b
+}
+
+// testMKV returns file with SeekHead, Info, clusters and Cues in the end, and offsets of clusters
+func testMKV() ([]byte, []int64) {
+	seekHead := func(cuesPosition uint64) []byte {
+		return mkvElement(mkvSeekHead,
+			mkvElement(mkvSeek, mkvElement(mkvSeekID, ebmlID(mkvCues)), mkvElement(mkvSeekPosition, be64(cuesPosition))),
+		)
+	}
+	info := mkvElement(mkvInfo,
+		mkvElement(mkvTimestampScale, be64(1000000)),
+		mkvElement(mkvDuration, be64(math.Float64bits(testChunks*1000))),
+	)
+
+	// Positions are relative to the segment data
+	pos := uint64(len(seekHead(0)) + len(info))
+	clusters := []byte{}
+	positions := []uint64{}
+	for i := 0; i < testChunks; i++ {
+		positions = append(positions, pos)
+		cluster := mkvElement(mkvCluster, make([]byte, testChunkSize))
+		clusters = append(clusters, cluster...)
+		pos += uint64(len(cluster))
+	}
+
+	cuePoints := []byte{}
+	for i, p := range positions {
+		cuePoints = append(cuePoints, mkvElement(mkvCuePoint,
+			mkvElement(mkvCueTime, be64(uint64(i*1000))),
+			mkvElement(mkvCueTrackPositions, mkvElement(mkvCueClusterPosition, be64(p))),
+		)...)
+	}
+
+	header := mkvElement(mkvEBML)
+	segment := mkvElement(mkvSegment, seekHead(pos), info, clusters, mkvElement(mkvCues, cuePoints))
+
+	// Segment data starts after EBML header, Segment ID and 8 bytes size
+	segmentStart := int64(len(header) + len(ebmlID(mkvSegment)) + 8)
+	ret := make([]int64, len(positions))
+	for i, p := range positions {
+		ret[i] = segmentStart + int64(p)
+	}
+	return append(header, segment...), ret
+}
+
+func TestParseContainerIndex(t *testing.T) {
+	mp4First, mp4FirstOffsets := testMP4(true)
+	mp4Last, mp4LastOffsets := testMP4(false)
+	mkv, mkvOffsets := testMKV()
+
+	tests := []struct {
+		name    string
+		file    string
+		data    []byte
+		format  string
+		offsets []int64
+	}{
+		{name: "moov first", file: "video.mp4", data: mp4First, format: containerMP4, offsets: mp4FirstOffsets},
+		{name: "moov last", file: "video.m4v", data: mp4Last, format: containerMP4, offsets: mp4LastOffsets},
+		{name: "seekhead to cues", file: "video.mkv", data: mkv, format: containerMKV, offsets: mkvOffsets},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ci, err := parseContainerIndex(bytes.NewReader(tt.data), tt.file, int64(len(tt.data)))
+			if err != nil {
+				t.Fatalf("parseContainerIndex() error = %v", err)
+			}
+
+			if ci.Format != tt.format {
+				t.Errorf("Format = %s, want %s", ci.Format, tt.format)
+			}
+			if ci.Duration != testChunks*time.Second {
+				t.Errorf("Duration = %s, want %s", ci.Duration, testChunks*time.Second)
+			}
+			if len(ci.Ranges) == 0 {
+				t.Errorf("Ranges are empty")
+			}
+			if len(ci.points) != len(tt.offsets) {
+				t.Fatalf("Seek points = %d, want %d", len(ci.points), len(tt.offsets))
+			}
+			for i, off := range tt.offsets {
+				if ci.points[i].offset != off || ci.points[i].time != time.Duration(i)*time.Second {
+					t.Errorf("Seek point %d = %+v, want offset %d at %s", i, ci.points[i], off, time.Duration(i)*time.Second)
+				}
+			}
+		})
+	}
+}
+
+func TestParseContainerIndexRanges(t *testing.T) {
+	data, _ := testMP4(false)
+	moov := testMoov(make([]uint32, testChunks))
+	moovStart := int64(len(data) - len(moov))
+
+	ci, err := parseContainerIndex(bytes.NewReader(data), "video.mp4", int64(len(data)))
+	if err != nil {
+		t.Fatalf("parseContainerIndex() error = %v", err)
+	}
+	if len(ci.Ranges) != 1 || ci.Ranges[0] != (ByteRange{Start: moovStart, End: int64(len(data))}) {
+		t.Errorf("Ranges = %v, want moov range %d-%d", ci.Ranges, moovStart, len(data))
+	}
+
+	mkv, mkvOffsets := testMKV()
+	ci, err = parseContainerIndex(bytes.NewReader(mkv), "video.mkv", int64(len(mkv)))
+	if err != nil {
+		t.Fatalf("parseContainerIndex() error = %v", err)
+	}
+
+	// SeekHead, Info and Cues, the last one is behind the clusters
+	if len(ci.Ranges) != 3 {
+		t.Fatalf("Ranges = %v, want 3 ranges", ci.Ranges)
+	}
+	if cues := ci.Ranges[2]; cues.Start <= mkvOffsets[len(mkvOffsets)-1] || cues.End != int64(len(mkv)) {
+		t.Errorf("Cues range = %v, want range after the last cluster till the end", cues)
+	}
+}
+
+func TestParseContainerIndexMissing(t *testing.T) {
+	mp4, _ := testMP4(false)
+	mkv, _ := testMKV()
+
+	tests := []struct {
+		name string
+		file string
+		data []byte
+	}{
+		{name: "moov last", file: "video.mp4", data: mp4},
+		{name: "cues last", file: "video.mkv", data: mkv},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// Only the beginning of the file is downloaded, parser asks for the index in the end
+			r := &partialReader{data: tt.data, limit: int64(len(tt.data) / 2)}
+			_, err := parseContainerIndex(r, tt.file, int64(len(tt.data)))
+
+			var missing *missingRangeError
+			if !errors.As(err, &missing) {
+				t.Fatalf("parseContainerIndex() error = %v, want missing range", err)
+			}
+			if missing.Offset+missing.Length <= r.limit {
+				t.Errorf("Missing range %d-%d is already downloaded", missing.Offset, missing.Offset+missing.Length)
+			}
+
+			r.limit = int64(len(tt.data))
+			if _, err := parseContainerIndex(r, tt.file, int64(len(tt.data))); err != nil {
+				t.Errorf("parseContainerIndex() error = %v after download", err)
+			}
+		})
+	}
+}
+
+func TestParseContainerIndexInvalid(t *testing.T) {
+	largeSize := func(size uint64) []byte {
+		b := append(be32(1), []byte("free")...)
+		return append(mp4Box("ftyp", []byte("isom")), append(b, be64(size)...)...)
+	}
+	seekPosition := func(position uint64) []byte {
+		return append(mkvElement(mkvEBML), mkvElement(mkvSegment,
+			mkvElement(mkvSeekHead, mkvElement(mkvSeek, mkvElement(mkvSeekID, ebmlID(mkvCues)), mkvElement(mkvSeekPosition, be64(position)))),
+		)...)
+	}
+	track := func(stbl ...[]byte) []byte {
+		return mp4Box("moov", mp4Box("trak", mp4Box("mdia",
+			mp4Box("mdhd", be32(0, 0, 0, 1000, 1000)),
+			mp4Box("hdlr", be32(0, 0), []byte("vide")),
+			mp4Box("minf", mp4Box("stbl", stbl...)),
+		)))
+	}
+
+	tests := []struct {
+		name string
+		file string
+		data []byte
+		size int64
+	}{
+		{name: "empty mp4", file: "video.mp4", data: []byte{}},
+		{name: "short header", file: "video.mp4", data: []byte{0, 0, 0}},
+		{name: "box smaller than header", file: "video.mp4", data: append(be32(4), []byte("ftyp")...)},
+		{name: "box bigger than file", file: "video.mp4", data: append(be32(1000), []byte("ftyp")...)},
+		{name: "largesize overflow", file: "video.mp4", data: largeSize(math.MaxInt64)},
+		{name: "negative largesize", file: "video.mp4", data: largeSize(math.MaxUint64)},
+		{name: "moov bigger than limit", file: "video.mp4", data: append(be32(maxContainerIndexSize+16), []byte("moov")...), size: 2 * maxContainerIndexSize},
+		{name: "child bigger than moov", file: "video.mp4", data: mp4Box("moov", be32(1000), []byte("trak"))},
+		{name: "counts bigger than boxes", file: "video.mp4", data: track(
+			mp4Box("stts", be32(0, math.MaxUint32, 1, 1000)),
+			mp4Box("stsc", be32(0, math.MaxUint32, 1, 1, 1)),
+			mp4Box("stco", be32(0, math.MaxUint32, 100)),
+		)},
+		{name: "truncated tables", file: "video.mp4", data: track(
+			mp4Box("stts", be32(0, 1, 1)),
+			mp4Box("stsc", be32(0, 1)),
+			mp4Box("co64", be32(0, 1, 0)),
+		)},
+		{name: "no moov", file: "video.mp4", data: mp4Box("ftyp", []byte("isom"))},
+		{name: "fragmented", file: "video.mp4", data: append(mp4Box("ftyp"), mp4Box("moof")...)},
+		{name: "empty mkv", file: "video.mkv", data: []byte{}},
+		{name: "zero vint", file: "video.mkv", data: []byte{0, 0, 0, 0}},
+		{name: "not ebml", file: "video.mkv", data: mkvElement(mkvSegment)},
+		{name: "no segment", file: "video.mkv", data: mkvElement(mkvEBML)},
+		{name: "huge segment", file: "video.mkv", data: append(mkvElement(mkvEBML), append(ebmlID(mkvSegment), 0x01, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF, 0xFE)...)},
+		{name: "huge element", file: "video.mkv", data: append(mkvElement(mkvEBML), mkvElement(mkvSegment, append(ebmlID(mkvInfo), 0x01, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF, 0xFE))...)},
+		{name: "seek position after end", file: "video.mkv", data: seekPosition(1 << 62)},
+		{name: "negative seek position", file: "video.mkv", data: seekPosition(1 << 63)},
+		{name: "unsupported", file: "video.avi", data: []byte("RIFF")},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			size := tt.size
+			if size == 0 {
+				size = int64(len(tt.data))
+			}
+
+			// Invalid files could be parsed partially, only errors and panics matter here
+			r := &partialReader{data: tt.data, limit: int64(len(tt.data))}
+			ci, err := parseContainerIndex(r, tt.file, size)
+			if err == nil && ci == nil {
+				t.Errorf("parseContainerIndex() returned neither index nor error")
+			}
+		})
+	}
+}
+
+func TestParseContainerIndexTruncated(t *testing.T) {
+	mp4First, _ := testMP4(true)
+	mp4Last, _ := testMP4(false)
+	mkv, _ := testMKV()
+
+	for _, tt := range []struct {
+		file string
+		data []byte
+	}{
+		{file: "first.mp4", data: mp4First},
+		{file: "last.mp4", data: mp4Last},
+		{file: "video.mkv", data: mkv},
+	} {
+		for size := 0; size < len(tt.data); size++ {
+			// File is cut, but its size is reported as full, then as cut
+			data := tt.data[:size]
+			parseContainerIndex(bytes.NewReader(data), tt.file, int64(len(tt.data)))
+			parseContainerIndex(bytes.NewReader(data), tt.file, int64(size))
+		}
+	}
+}
+
+func TestContainerIndexTime(t *testing.T) {
+	ci := &ContainerIndex{
+		Size:     10000,
+		Duration: 10 * time.Second,
+		points: []indexPoint{
+			{offset: 1000, time: 0},
+			{offset: 2000, time: 2 * time.Second},
+			{offset: 6000, time: 4 * time.Second},
+		},
+	}
+
+	tests := []struct {
+		offset int64
+		time   time.Duration
+	}{
+		{offset: 0, time: 0},
+		{offset: 1000, time: 0},
+		{offset: 1500, time: time.Second},
+		{offset: 2000, time: 2 * time.Second},
+		{offset: 4000, time: 3 * time.Second},
+		{offset: 6000, time: 4 * time.Second},
+		{offset: 8000, time: 7 * time.Second},
+		{offset: 10000, time: 10 * time.Second},
+	}
+
+	for _, tt := range tests {
+		if got := ci.TimeAt(tt.offset); got != tt.time {
+			t.Errorf("TimeAt(%d) = %s, want %s", tt.offset, got, tt.time)
+		}
+		// Offsets before the first point have no own time
+		if tt.offset < 1000 {
+			continue
+		}
+		if got := ci.OffsetAt(tt.time); got != tt.offset {
+			t.Errorf("OffsetAt(%s) = %d, want %d", tt.time, got, tt.offset)
+		}
+	}
+
+	// Without seek points time is proportional to offset
+	ci.points = nil
+	if got := ci.TimeAt(2500); got != 2500*time.Millisecond {
+		t.Errorf("TimeAt(2500) without points = %s, want 2.5s", got)
+	}
+	if got := ci.OffsetAt(2500 * time.Millisecond); got != 2500 {
+		t.Errorf("OffsetAt(2.5s) without points = %d, want 2500", got)
+	}
+	if got := ci.Bitrate(); got != 1000 {
+		t.Errorf("Bitrate() = %d, want 1000", got)
+	}
+}
+
+func TestContainerIndexBitrateAt(t *testing.T) {
+	ci := &ContainerIndex{
+		Size:     10000,
+		Duration: 10 * time.Second,
+		points: []indexPoint{
+			{offset: 0, time: 0},
+			{offset: 1000, time: 5 * time.Second},
+			{offset: 9000, time: 6 * time.Second},
+		},
+	}
+
+	// First 5 seconds take 1000 bytes, the next second takes 8000 bytes
+	if got := ci.BitrateAt(0, 5*time.Second); got != 200 {
+		t.Errorf("BitrateAt(0, 5s) = %d, want 200", got)
+	}
+	if got := ci.BitrateAt(1000, time.Second); got != 8000 {
+		t.Errorf("BitrateAt(1000, 1s) = %d, want 8000", got)
+	}
+	if got := ci.BitrateAt(0, 0); got != ci.Bitrate() {
+		t.Errorf("BitrateAt(0, 0) = %d, want average %d", got, ci.Bitrate())
+	}
+}
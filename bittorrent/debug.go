@@ -10,6 +10,7 @@ import (
 	"time"
 
 	"github.com/anacrolix/missinggo/perf"
+	"github.com/dustin/go-humanize"
 	"github.com/gin-gonic/gin"
 
 	"github.com/elgatito/elementum/config"
@@ -37,6 +38,9 @@ func DebugAll(s *Service) gin.HandlerFunc {
 
 		writeHeader(ctx.Writer, "Debug Vars")
 		writeResponse(ctx.Writer, "/debug/vars")
+
+		writeHeader(ctx.Writer, "Debug Readers")
+		writeResponse(ctx.Writer, "/debug/readers")
 	}
 }
 
@@ -82,11 +86,71 @@ func DebugBundle(s *Service) gin.HandlerFunc {
 		writeHeader(ctx.Writer, "Debug Vars")
 		writeResponse(ctx.Writer, "/debug/vars")
 
+		writeHeader(ctx.Writer, "Debug Readers")
+		writeResponse(ctx.Writer, "/debug/readers")
+
 		writeHeader(ctx.Writer, "kodi.log")
 		io.Copy(ctx.Writer, logFile)
 	}
 }
 
+// DebugReaders shows readahead window and rates of each active reader
+func DebugReaders(s *Service) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		defer perf.ScopeTimer()()
+
+		ctx.Writer.Header().Set("Content-Type", "text/plain; charset=utf-8")
+
+		for _, t := range s.q.All() {
+			if t == nil || t.Closer.IsSet() || !t.HasMetadata() {
+				continue
+			}
+
+			t.muReaders.Lock()
+			readers := make([]*TorrentFSEntry, 0, len(t.readers))
+			for _, r := range t.readers {
+				readers = append(readers, r)
+			}
+			t.muReaders.Unlock()
+
+			if len(readers) == 0 {
+				continue
+			}
+
+			playing, duration := t.playingDuration()
+			fmt.Fprintf(ctx.Writer, "%s (%s, memory: %s, readahead budget: %s)\n",
+				t.Name(), config.Storages[t.DownloadStorage], humanize.Bytes(uint64(t.MemorySize)), humanize.Bytes(uint64(t.GetReadaheadSize())))
+
+			for _, r := range readers {
+				state := "idle"
+				if r.IsHead() {
+					state = "head"
+				} else if r.IsActive() {
+					state = "active"
+				}
+
+				pos, _ := r.Pos()
+				window := r.ReaderPiecesRange()
+				bitrate, source := r.bitrate(playing, duration)
+				if source == "" {
+					source = "unknown"
+				}
+
+				held := "-"
+				if bitrate > 0 {
+					held = (time.Duration(r.Readahead()/bitrate) * time.Second).String()
+				}
+
+				fmt.Fprintf(ctx.Writer, "  Reader %d (%s): %s\n", r.id, state, r.f.Path)
+				fmt.Fprintf(ctx.Writer, "    Position: %s / %s\n", humanize.Bytes(uint64(pos)), humanize.Bytes(uint64(r.f.Size)))
+				fmt.Fprintf(ctx.Writer, "    Window:   %s, pieces %d-%d, holds %s of playback\n", humanize.Bytes(uint64(r.Readahead())), window.Begin, window.End, held)
+				fmt.Fprintf(ctx.Writer, "    Rate:     %s/s consumed, %s/s bitrate (%s)\n", humanize.Bytes(uint64(r.rate.get())), humanize.Bytes(uint64(bitrate)), source)
+			}
+			fmt.Fprint(ctx.Writer, "\n")
+		}
+	}
+}
+
 func writeHeader(w http.ResponseWriter, title string) {
 	w.Write([]byte("\n\n" + strings.Repeat("-", 70) + "\n"))
 	w.Write([]byte(title))
@@ -0,0 +1,251 @@
+package bittorrent
+
+import (
+	"encoding/base64"
+	"sort"
+
+	lt "github.com/ElementumOrg/libtorrent-go"
+)
+
+// TorrentDetails is a machine-readable snapshot of torrent state
+type TorrentDetails struct {
+	InfoHash    string  `json:"infohash"`
+	Name        string  `json:"name"`
+	Status      string  `json:"status"`
+	StatusCode  int     `json:"status_code"`
+	Progress    float64 `json:"progress"`
+	TotalSize   int64   `json:"total_size"`
+	PieceLength int     `json:"piece_length"`
+	NumPieces   int     `json:"num_pieces"`
+	SavePath    string  `json:"save_path"`
+	Category    string  `json:"category"`
+
+	DownloadRate int `json:"download_rate"`
+	UploadRate   int `json:"upload_rate"`
+
+	Peers    DetailsPeers      `json:"peers"`
+	Files    []*DetailsFile    `json:"files"`
+	Pieces   DetailsPieces     `json:"pieces"`
+	Trackers []*DetailsTracker `json:"trackers"`
+	Readers  []*DetailsReader  `json:"readers"`
+}
+
+// DetailsPeers contains connected peers counters.
+// Per-peer list (address, client, flags, rates, progress) needs torrent_handle::get_peer_info,
+// which is not wrapped by libtorrent-go (stdVectorPeerInfo template is disabled in torrent_handle.i),
+// so only aggregated values are available until bindings expose it.
+type DetailsPeers struct {
+	Connections   int `json:"connections"`
+	Seeds         int `json:"seeds"`
+	Peers         int `json:"peers"`
+	SeedsTotal    int `json:"seeds_total"`
+	PeersTotal    int `json:"peers_total"`
+	ListSeeds     int `json:"list_seeds"`
+	ListPeers     int `json:"list_peers"`
+	NumComplete   int `json:"num_complete"`
+	NumIncomplete int `json:"num_incomplete"`
+}
+
+// DetailsFile describes file download state
+type DetailsFile struct {
+	Index      int     `json:"index"`
+	Path       string  `json:"path"`
+	Size       int64   `json:"size"`
+	Priority   int     `json:"priority"`
+	Progress   float64 `json:"progress"`
+	PieceStart int     `json:"piece_start"`
+	PieceEnd   int     `json:"piece_end"`
+}
+
+// DetailsPieces contains pieces bitfield, encoded with base64, first piece is the highest bit of the first byte
+type DetailsPieces struct {
+	Total    int    `json:"total"`
+	Done     int    `json:"done"`
+	Bitfield string `json:"bitfield"`
+}
+
+// DetailsTracker describes tracker announce state
+type DetailsTracker struct {
+	URL            string `json:"url"`
+	Tier           int    `json:"tier"`
+	Working        bool   `json:"working"`
+	Updating       bool   `json:"updating"`
+	Fails          int    `json:"fails"`
+	Seeds          int    `json:"seeds"`
+	Peers          int    `json:"peers"`
+	Message        string `json:"message"`
+	LastError      string `json:"last_error"`
+	AnnouncedPeers int    `json:"announced_peers"`
+}
+
+// DetailsReader describes active TorrentFSEntry reader
+type DetailsReader struct {
+	ID        int64      `json:"id"`
+	File      string     `json:"file"`
+	Position  int64      `json:"position"`
+	Readahead int64      `json:"readahead"`
+	Pieces    PieceRange `json:"pieces"`
+	IsActive  bool       `json:"is_active"`
+	IsHead    bool       `json:"is_head"`
+	IsIdle    bool       `json:"is_idle"`
+}
+
+// Details collects torrent state for inspection
+func (t *Torrent) Details() *TorrentDetails {
+	if t.Closer.IsSet() || t.th == nil || t.th.Swigcptr() == 0 {
+		return nil
+	}
+
+	st := t.GetLastStatus(true)
+	if st == nil || st.Swigcptr() == 0 {
+		return nil
+	}
+
+	d := &TorrentDetails{
+		InfoHash:   t.InfoHash(),
+		Name:       t.Name(),
+		StatusCode: t.GetSmartState(),
+		Progress:   t.GetProgress(),
+		SavePath:   t.GetSavePath(),
+		Category:   t.GetCategory(),
+
+		DownloadRate: st.GetDownloadPayloadRate(),
+		UploadRate:   st.GetUploadPayloadRate(),
+
+		Files:    []*DetailsFile{},
+		Trackers: []*DetailsTracker{},
+		Readers:  []*DetailsReader{},
+	}
+	d.Status = StatusStrings[d.StatusCode]
+
+	d.Peers.Seeds, d.Peers.SeedsTotal, d.Peers.Peers, d.Peers.PeersTotal = t.GetConnections()
+	d.Peers.Connections = st.GetNumConnections()
+	d.Peers.ListSeeds = st.GetListSeeds()
+	d.Peers.ListPeers = st.GetListPeers()
+	d.Peers.NumComplete = st.GetNumComplete()
+	d.Peers.NumIncomplete = st.GetNumIncomplete()
+
+	if t.ti != nil && t.ti.Swigcptr() != 0 {
+		d.TotalSize = t.ti.TotalSize()
+		d.PieceLength = t.ti.PieceLength()
+		d.NumPieces = t.ti.NumPieces()
+
+		d.Pieces = t.detailsPieces(d.NumPieces)
+		d.Files = t.detailsFiles()
+	}
+
+	d.Trackers = t.detailsTrackers()
+	d.Readers = t.detailsReaders()
+
+	return d
+}
+
+func (t *Torrent) detailsPieces(numPieces int) (ret DetailsPieces) {
+	ret.Total = numPieces
+
+	bitfield := make(Bitfield, (numPieces+7)/8)
+	for i := 0; i < numPieces; i++ {
+		if t.hasPiece(i) {
+			bitfield.SetBit(i, true)
+			ret.Done++
+		}
+	}
+	ret.Bitfield = base64.StdEncoding.EncodeToString(bitfield)
+
+	return
+}
+
+func (t *Torrent) detailsFiles() []*DetailsFile {
+	ret := []*DetailsFile{}
+
+	filePriorities := t.th.FilePriorities()
+	defer lt.DeleteStdVectorInt(filePriorities)
+
+	for _, f := range t.files {
+		df := &DetailsFile{
+			Index:      f.Index,
+			Path:       f.Path,
+			Size:       f.Size,
+			PieceStart: f.PieceStart,
+			PieceEnd:   f.PieceEnd,
+		}
+		if f.Index < int(filePriorities.Size()) {
+			df.Priority = filePriorities.Get(f.Index)
+		}
+
+		// Progress is estimated by completed pieces, covering the file
+		if total := f.PieceEnd - f.PieceStart + 1; total > 0 {
+			done := 0
+			for i := f.PieceStart; i <= f.PieceEnd; i++ {
+				if t.hasPiece(i) {
+					done++
+				}
+			}
+			df.Progress = float64(done) * 100 / float64(total)
+		}
+
+		ret = append(ret, df)
+	}
+
+	sort.Slice(ret, func(i, j int) bool {
+		return ret[i].Index < ret[j].Index
+	})
+	return ret
+}
+
+func (t *Torrent) detailsTrackers() []*DetailsTracker {
+	ret := []*DetailsTracker{}
+
+	trackers := t.th.Trackers()
+	defer lt.DeleteStdVectorAnnounceEntry(trackers)
+
+	for i := 0; i < int(trackers.Size()); i++ {
+		tracker := trackers.Get(i)
+		dt := &DetailsTracker{
+			URL:      tracker.GetUrl(),
+			Tier:     int(tracker.GetTier()),
+			Working:  tracker.IsWorking(),
+			Updating: tracker.GetUpdating(),
+			Fails:    int(tracker.GetFails()),
+			Seeds:    tracker.GetScrapeComplete(),
+			Peers:    tracker.GetScrapeIncomplete(),
+			Message:  tracker.GetMessage(),
+		}
+		if ec := tracker.GetLastError(); ec.Failed() {
+			dt.LastError = ec.Message().(string)
+		}
+		if p, ok := t.trackers.Load(dt.URL); ok {
+			dt.AnnouncedPeers, _ = p.(int)
+		}
+
+		ret = append(ret, dt)
+	}
+
+	return ret
+}
+
+func (t *Torrent) detailsReaders() []*DetailsReader {
+	ret := []*DetailsReader{}
+
+	t.muReaders.Lock()
+	defer t.muReaders.Unlock()
+
+	for _, r := range t.readers {
+		pos, _ := r.Pos()
+		ret = append(ret, &DetailsReader{
+			ID:        r.id,
+			File:      r.f.Path,
+			Position:  pos,
+			Readahead: r.Readahead(),
+			Pieces:    r.ReaderPiecesRange(),
+			IsActive:  r.IsActive(),
+			IsHead:    r.IsHead(),
+			IsIdle:    r.IsIdle(),
+		})
+	}
+
+	sort.Slice(ret, func(i, j int) bool {
+		return ret[i].ID < ret[j].ID
+	})
+	return ret
+}
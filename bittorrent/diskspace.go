@@ -0,0 +1,152 @@
+package bittorrent
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/dustin/go-humanize"
+
+	"github.com/elgatito/elementum/config"
+	"github.com/elgatito/elementum/database"
+	"github.com/elgatito/elementum/diskusage"
+	"github.com/elgatito/elementum/xbmc"
+)
+
+const (
+	// DiskSpaceOK means all watched paths have enough free space
+	DiskSpaceOK = iota
+	// DiskSpaceLow means torrents, that are not played, are paused
+	DiskSpaceLow
+	// DiskSpaceCritical means non-essential writes are stopped as well
+	DiskSpaceCritical
+)
+
+func (s *Service) watchDiskSpace() {
+	closing := s.Closer.C()
+	ticker := time.NewTicker(30 * time.Second)
+	defer ticker.Stop()
+
+	s.checkDiskSpace()
+
+	for {
+		select {
+		case <-closing:
+			return
+
+		case <-ticker.C:
+			s.checkDiskSpace()
+		}
+	}
+}
+
+// IsDiskSpaceCritical checks whether non-essential writes should be skipped
+func (s *Service) IsDiskSpaceCritical() bool {
+	s.muDiskSpace.Lock()
+	defer s.muDiskSpace.Unlock()
+
+	return s.diskSpaceLevel == DiskSpaceCritical
+}
+
+// checkDiskSpace compares free space on download, categories, torrents and profile paths with thresholds,
+// pauses torrents, that are not played, when it is low, and stops writes when it is critical.
+func (s *Service) checkDiskSpace() {
+	if s.config.DiskLowSpace <= 0 && s.config.DiskCriticalSpace <= 0 {
+		s.setDiskSpaceLevel(DiskSpaceOK, "", 0)
+		return
+	}
+
+	level := DiskSpaceOK
+	lowPath := ""
+	lowFree := int64(0)
+
+	seen := map[string]bool{}
+	for _, path := range append(s.getSavePaths(), s.config.TorrentsPath, config.Get().Info.Profile) {
+		if path == "" || path == "." || seen[path] {
+			continue
+		}
+		seen[path] = true
+
+		status, err := diskusage.DiskUsage(path)
+		if err != nil || status == nil || status.All <= 0 {
+			continue
+		}
+
+		pathLevel := DiskSpaceOK
+		if s.config.DiskCriticalSpace > 0 && status.Free < s.config.DiskCriticalSpace {
+			pathLevel = DiskSpaceCritical
+		} else if s.config.DiskLowSpace > 0 && status.Free < s.config.DiskLowSpace {
+			pathLevel = DiskSpaceLow
+		}
+
+		if pathLevel > level || (pathLevel == level && pathLevel != DiskSpaceOK && status.Free < lowFree) {
+			level = pathLevel
+			lowPath = path
+			lowFree = status.Free
+		}
+	}
+
+	s.setDiskSpaceLevel(level, lowPath, lowFree)
+}
+
+// setDiskSpaceLevel decides which torrents to pause or resume under the lock,
+// pausing, resuming and notifying is done after it is released.
+func (s *Service) setDiskSpaceLevel(level int, path string, free int64) {
+	s.muDiskSpace.Lock()
+	previous := s.diskSpaceLevel
+	s.diskSpaceLevel = level
+	database.SuspendWrites(level == DiskSpaceCritical)
+
+	var toResume []string
+	var toPause []*Torrent
+	if level == DiskSpaceOK {
+		toResume = s.diskSpacePaused
+		s.diskSpacePaused = nil
+	} else {
+		// Torrents, added while space is low, are paused as well
+		for _, t := range s.GetTorrents() {
+			if t == nil || t.Closer.IsSet() || t.IsMemoryStorage() || t.IsPreview || t.PlayerAttached > 0 || t.IsBuffering || t.IsPaused {
+				continue
+			}
+
+			toPause = append(toPause, t)
+			s.diskSpacePaused = append(s.diskSpacePaused, t.InfoHash())
+		}
+	}
+	s.muDiskSpace.Unlock()
+
+	if level == DiskSpaceOK {
+		if previous != DiskSpaceOK {
+			log.Infof("Free disk space is back to normal")
+		}
+
+		for _, hash := range toResume {
+			if t := s.GetTorrentByHash(hash); t != nil && t.IsPaused {
+				log.Infof("Resuming %s, free disk space is back to normal", t.Name())
+				t.Resume()
+			}
+		}
+		if len(toResume) > 0 {
+			go s.UpdateQueue()
+		}
+		return
+	}
+
+	for _, t := range toPause {
+		log.Infof("Pausing %s, free disk space is low", t.Name())
+		t.Pause()
+	}
+
+	if level > previous {
+		message := fmt.Sprintf("Low disk space on %s: %s free", path, humanize.Bytes(uint64(free)))
+		notification := fmt.Sprintf("LOCALIZE[30754];;%s;;%s", path, humanize.Bytes(uint64(free)))
+		if level == DiskSpaceCritical {
+			message = fmt.Sprintf("Critical disk space on %s: %s free, writes are stopped", path, humanize.Bytes(uint64(free)))
+			notification = fmt.Sprintf("LOCALIZE[30755];;%s;;%s", path, humanize.Bytes(uint64(free)))
+		}
+
+		log.Warning(message)
+		if xbmcHost, err := xbmc.GetLocalXBMCHost(); xbmcHost != nil && err == nil {
+			xbmcHost.Notify("Elementum", notification, config.AddonIcon())
+		}
+	}
+}
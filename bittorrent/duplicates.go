@@ -0,0 +1,121 @@
+package bittorrent
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/elgatito/elementum/database"
+)
+
+// Duplicate is an existing download of the same movie or episode with another infohash,
+// either an active torrent, or files of finished download, kept on disk.
+type Duplicate struct {
+	Torrent *Torrent
+	Item    *database.DownloadedItem
+	Path    string
+}
+
+// Name returns name of the existing download
+func (d *Duplicate) Name() string {
+	if d.Torrent != nil {
+		return d.Torrent.Name()
+	}
+	return d.Item.Name
+}
+
+// downloadedKey returns key of finished download for a movie or an episode, other types are not tracked
+func downloadedKey(mediaType string, tmdbID, showID, season, episode int) string {
+	if mediaType == movieType && tmdbID > 0 {
+		return fmt.Sprintf("%s_%d", movieType, tmdbID)
+	} else if mediaType == episodeType && showID > 0 {
+		return fmt.Sprintf("%s_%d_%d_%d", episodeType, showID, season, episode)
+	}
+	return ""
+}
+
+// recordDownloaded saves chosen files of finished torrent, assigned to a movie or an episode
+func (s *Service) recordDownloaded(t *Torrent) {
+	item := t.DBItem
+	if item == nil || t.IsPreview || t.IsMemoryStorage() {
+		return
+	}
+
+	key := downloadedKey(item.Type, item.ID, item.ShowID, item.Season, item.Episode)
+	if key == "" {
+		return
+	}
+
+	files := []string{}
+	for _, f := range t.ChosenFiles {
+		files = append(files, filepath.Join(t.GetSavePath(), f.Path))
+	}
+	if len(files) == 0 {
+		return
+	}
+
+	if err := database.GetStorm().AddDownloadedItem(key, t.InfoHash(), t.Name(), files); err != nil {
+		log.Warningf("Could not save downloaded item for %s: %s", t.Name(), err)
+	}
+}
+
+// FindDuplicate looks for active torrent or finished download of the same movie or episode,
+// with infohash, other than the one, that is being added.
+func (s *Service) FindDuplicate(mediaType string, tmdbID, showID, season, episode int, infoHash string) *Duplicate {
+	var t *Torrent
+	if mediaType == movieType && tmdbID > 0 {
+		t = s.HasTorrentByID(tmdbID)
+	} else if mediaType == episodeType && showID > 0 {
+		t = s.HasTorrentByEpisode(showID, season, episode)
+	}
+	if t != nil && t.InfoHash() != infoHash && !t.IsPreview {
+		return &Duplicate{Torrent: t}
+	}
+
+	key := downloadedKey(mediaType, tmdbID, showID, season, episode)
+	if key == "" {
+		return nil
+	}
+	item := database.GetStorm().GetDownloadedItem(key)
+	if item == nil || item.InfoHash == infoHash {
+		return nil
+	}
+
+	// The biggest file is the video to play, files could be removed since then
+	path := ""
+	size := int64(-1)
+	for _, f := range item.Files {
+		if st, err := os.Stat(f); err == nil && !st.IsDir() && st.Size() > size {
+			path = f
+			size = st.Size()
+		}
+	}
+	if path == "" {
+		database.GetStorm().DeleteDownloadedItem(key)
+		return nil
+	}
+
+	return &Duplicate{Item: item, Path: path}
+}
+
+// RemoveDuplicate removes existing download with its files, to replace it with a new one
+func (s *Service) RemoveDuplicate(d *Duplicate) error {
+	if d.Torrent != nil {
+		if d.Torrent.PlayerAttached > 0 {
+			return errors.New("Torrent is being played")
+		}
+		if !s.RemoveTorrent(nil, d.Torrent, RemoveOptions{ForceDrop: true, ForceDelete: true}) {
+			return fmt.Errorf("Unable to remove %s", d.Torrent.Name())
+		}
+		return nil
+	}
+
+	for _, f := range d.Item.Files {
+		if err := os.Remove(f); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+		log.Infof("Removed duplicate file %s", f)
+	}
+	return database.GetStorm().DeleteDownloadedItem(d.Item.Key)
+}
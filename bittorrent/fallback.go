@@ -0,0 +1,177 @@
+package bittorrent
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/elgatito/elementum/config"
+)
+
+// FallbackFunc returns alternative releases for the played item, sorted from the best one
+type FallbackFunc func() []*TorrentFile
+
+// SetFallback sets the source of alternative releases, used when buffering is stalled
+func (btp *Player) SetFallback(f FallbackFunc) {
+	btp.fallback = f
+}
+
+var errNoFallback = errors.New("No alternative releases found")
+
+// fallbackResult is an alternative torrent, added in background, or the reason it was not added
+type fallbackResult struct {
+	torrent *Torrent
+	uri     string
+	err     error
+}
+
+// isBufferStalled checks whether buffering made no progress for BufferTimeout seconds,
+// or torrent stays in stalled state for that long, even if buffering has not started yet.
+// Only torrents, added by this player, are replaced, to keep existing downloads untouched.
+func (btp *Player) isBufferStalled() bool {
+	if btp.fallback == nil || !btp.addedTorrent || btp.p.Background || !config.Get().AutoReplaceStalled || btp.closer.IsSet() {
+		return false
+	} else if btp.t == nil || btp.t.IsBufferingFinished {
+		return false
+	}
+
+	timeout := time.Duration(config.Get().BufferTimeout) * time.Second
+	if timeout <= 0 {
+		return false
+	}
+
+	state := -1
+	if st := btp.t.GetLastStatus(false); st != nil {
+		state = int(st.GetState())
+	}
+
+	if state == StatusStalled {
+		if btp.bufferStallCheck.IsZero() {
+			btp.bufferStallCheck = time.Now()
+			return false
+		}
+	} else if !btp.t.IsBuffering {
+		btp.bufferStallCheck = time.Time{}
+		return false
+	} else if btp.bufferStallCheck.IsZero() || btp.t.BufferProgress > btp.bufferStallLast || state == StatusChecking {
+		// Checking state is not a stall, even if it takes long
+		btp.bufferStallCheck = time.Now()
+		btp.bufferStallLast = btp.t.BufferProgress
+		return false
+	}
+
+	return time.Since(btp.bufferStallCheck) >= timeout
+}
+
+// addFallbackTorrent adds the next-best release, it is called in background,
+// since search for alternatives could take long, and should not block buffer dialog.
+func (btp *Player) addFallbackTorrent(old *Torrent, fallback FallbackFunc) fallbackResult {
+	log.Warningf("Buffering of %s is stalled for %d seconds, looking for alternative release", old.Name(), config.Get().BufferTimeout)
+
+	var alt *TorrentFile
+	for _, c := range fallback() {
+		if c == nil || c.URI == "" || (c.InfoHash != "" && btp.isFallbackTried(c.InfoHash)) || c.URI == btp.p.URI {
+			continue
+		}
+		alt = c
+		break
+	}
+	if alt == nil {
+		return fallbackResult{err: errNoFallback}
+	}
+	if alt.InfoHash != "" {
+		btp.setFallbackTried(alt.InfoHash)
+	}
+
+	torrent, err := btp.s.AddTorrent(btp.xbmcHost, AddOptions{URI: alt.URI, Paused: false, DownloadStorage: old.DownloadStorage, FirstTime: true, AddedTime: time.Now()})
+	if err != nil {
+		return fallbackResult{err: err}
+	} else if torrent == nil {
+		return fallbackResult{err: fmt.Errorf("Unable to add torrent with URI %s", alt.URI)}
+	}
+	btp.setFallbackTried(torrent.InfoHash())
+
+	return fallbackResult{torrent: torrent, uri: alt.URI}
+}
+
+// startFallback looks for alternative release in background and sends the result to returned channel
+func (btp *Player) startFallback() chan fallbackResult {
+	old := btp.t
+	fallback := btp.fallback
+	btp.setFallbackTried(old.InfoHash())
+
+	// Do not try again for the same torrent, if there is nothing to replace it with
+	btp.bufferStallCheck = time.Now()
+
+	if btp.dialogProgress != nil {
+		btp.dialogProgress.Update(0, "LOCALIZE[30704]", old.Name(), "")
+	}
+
+	ret := make(chan fallbackResult, 1)
+	go func() {
+		ret <- btp.addFallbackTorrent(old, fallback)
+	}()
+	return ret
+}
+
+// dropFallback removes alternative torrent, that is not needed anymore, since buffering was cancelled
+func (btp *Player) dropFallback(result fallbackResult) {
+	if result.torrent != nil {
+		log.Infof("Removing alternative release %s, since buffering is cancelled", result.torrent.Name())
+		btp.s.RemoveTorrent(nil, result.torrent, RemoveOptions{ForceDrop: true, ForceDelete: true})
+	}
+}
+
+// replaceStalledTorrent swaps current torrent with the alternative release, keeping the same player
+func (btp *Player) replaceStalledTorrent(result fallbackResult) {
+	old := btp.t
+	torrent := result.torrent
+
+	log.Warningf("Replacing stalled torrent %s with %s", old.Name(), torrent.Name())
+	if btp.xbmcHost != nil {
+		btp.xbmcHost.Notify("Elementum", fmt.Sprintf("LOCALIZE[30705];;%s;;%s", old.Name(), torrent.Name()), config.AddonIcon())
+	}
+
+	// Detach and remove stalled torrent, nothing useful was downloaded
+	btp.s.DetachPlayer(btp)
+	btp.s.RemoveTorrent(nil, old, RemoveOptions{ForceDrop: true, ForceDelete: true})
+
+	// File indexes belong to the stalled torrent
+	btp.p.URI = result.uri
+	btp.p.ResumeHash = ""
+	btp.p.FileIndex = -1
+	btp.p.OriginalIndex = -1
+	btp.p.NextFileIndex = -1
+	btp.p.NextOriginalIndex = -1
+
+	btp.chosenFile = nil
+	btp.subtitlesFile = nil
+	btp.hasChosenFile = false
+	btp.isDownloading = false
+
+	btp.SetTorrent(torrent)
+	btp.t.IsBuffering = true
+	btp.bufferStallCheck = time.Now()
+	btp.bufferStallLast = 0
+
+	go btp.s.AttachPlayer(btp)
+	go btp.processMetadata()
+	go btp.waitCheckAvailableSpace()
+}
+
+func (btp *Player) isFallbackTried(infoHash string) bool {
+	btp.muFallback.Lock()
+	defer btp.muFallback.Unlock()
+
+	return btp.fallbackTried[infoHash]
+}
+
+func (btp *Player) setFallbackTried(infoHash string) {
+	btp.muFallback.Lock()
+	defer btp.muFallback.Unlock()
+
+	if btp.fallbackTried == nil {
+		btp.fallbackTried = map[string]bool{}
+	}
+	btp.fallbackTried[infoHash] = true
+}
@@ -0,0 +1,331 @@
+package bittorrent
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/goccy/go-json"
+
+	"github.com/elgatito/elementum/config"
+	"github.com/elgatito/elementum/database"
+	"github.com/elgatito/elementum/proxy"
+)
+
+const (
+	hooksFile = "hooks.json"
+
+	// HookTorrentFinished is fired when torrent finishes downloading
+	HookTorrentFinished = "finished"
+	// HookTorrentMoved is fired when completed torrent files are moved
+	HookTorrentMoved = "moved"
+	// HookTorrentRemoved is fired when torrent is removed from the session
+	HookTorrentRemoved = "removed"
+
+	hookDefaultTimeout = 30
+	hookLogSize        = 50
+	hookOutputSize     = 4096
+)
+
+// Hook is an external command or a webhook, executed on torrent events.
+// Command gets event details in ELEMENTUM_* environment variables,
+// webhook gets them as JSON payload in POST request.
+type Hook struct {
+	Name    string            `json:"name"`
+	Events  []string          `json:"events"`
+	Command string            `json:"command,omitempty"`
+	Args    []string          `json:"args,omitempty"`
+	URL     string            `json:"url,omitempty"`
+	Headers map[string]string `json:"headers,omitempty"`
+	Timeout int               `json:"timeout"`
+	Retries int               `json:"retries"`
+}
+
+// HookPayload describes torrent event
+type HookPayload struct {
+	Event     string   `json:"event"`
+	InfoHash  string   `json:"infohash"`
+	Name      string   `json:"name"`
+	SavePath  string   `json:"save_path"`
+	Category  string   `json:"category"`
+	MediaType string   `json:"media_type"`
+	TMDBID    int      `json:"tmdb_id"`
+	ShowID    int      `json:"show_id"`
+	Season    int      `json:"season"`
+	Episode   int      `json:"episode"`
+	Files     []string `json:"files,omitempty"`
+}
+
+// HookLogEntry is a result of hook execution
+type HookLogEntry struct {
+	Time     time.Time `json:"time"`
+	Event    string    `json:"event"`
+	InfoHash string    `json:"infohash"`
+	Name     string    `json:"name"`
+	Attempts int       `json:"attempts"`
+	Duration string    `json:"duration"`
+	Success  bool      `json:"success"`
+	Output   string    `json:"output"`
+	Error    string    `json:"error,omitempty"`
+}
+
+// HookStatus is a hook with its execution log
+type HookStatus struct {
+	*Hook
+	Log []*HookLogEntry `json:"log"`
+}
+
+// LoadHooks reads hooks from the profile folder
+func LoadHooks() ([]*Hook, error) {
+	filePath := filepath.Join(config.Get().ProfilePath, hooksFile)
+	b, err := os.ReadFile(filePath)
+	if err != nil {
+		return nil, err
+	}
+
+	hooks := []*Hook{}
+	if err := json.Unmarshal(b, &hooks); err != nil {
+		return nil, fmt.Errorf("Could not parse %s: %s", filePath, err)
+	}
+
+	names := map[string]bool{}
+	for _, h := range hooks {
+		if h.Name == "" || names[h.Name] {
+			return nil, fmt.Errorf("Hook name is empty or not unique: %q", h.Name)
+		}
+		names[h.Name] = true
+
+		if (h.Command == "") == (h.URL == "") {
+			return nil, fmt.Errorf("Hook %s should have either command or url", h.Name)
+		}
+		for _, e := range h.Events {
+			if e != HookTorrentFinished && e != HookTorrentMoved && e != HookTorrentRemoved {
+				return nil, fmt.Errorf("Unknown event for hook %s: %s", h.Name, e)
+			}
+		}
+		if h.Timeout <= 0 {
+			h.Timeout = hookDefaultTimeout
+		}
+		if h.Retries < 0 {
+			h.Retries = 0
+		}
+	}
+
+	return hooks, nil
+}
+
+// loadHooks reloads hooks file
+func (s *Service) loadHooks() {
+	s.muHooks.Lock()
+	defer s.muHooks.Unlock()
+
+	s.hooks = []*Hook{}
+	if s.hookLogs == nil {
+		s.hookLogs = map[string][]*HookLogEntry{}
+	}
+
+	hooks, err := LoadHooks()
+	if err != nil {
+		if !os.IsNotExist(err) {
+			log.Warningf("Could not load hooks: %s", err)
+		}
+		return
+	}
+
+	s.hooks = hooks
+	log.Infof("Loaded %d torrent hooks", len(hooks))
+}
+
+// GetHooks returns hooks with their execution logs, latest entries first
+func (s *Service) GetHooks() []*HookStatus {
+	s.muHooks.Lock()
+	defer s.muHooks.Unlock()
+
+	ret := make([]*HookStatus, 0, len(s.hooks))
+	for _, h := range s.hooks {
+		logs := s.hookLogs[h.Name]
+		hs := &HookStatus{Hook: h, Log: make([]*HookLogEntry, 0, len(logs))}
+		for i := len(logs) - 1; i >= 0; i-- {
+			hs.Log = append(hs.Log, logs[i])
+		}
+		ret = append(ret, hs)
+	}
+
+	return ret
+}
+
+// newHookPayload collects torrent information for hooks, should be called before torrent is dropped
+func (t *Torrent) newHookPayload(event string) *HookPayload {
+	p := &HookPayload{
+		Event:    event,
+		InfoHash: t.InfoHash(),
+		Name:     t.Name(),
+		SavePath: t.GetSavePath(),
+		Category: t.GetCategory(),
+	}
+
+	if item := t.DBItem; item != nil {
+		p.MediaType = item.Type
+		p.TMDBID = item.ID
+		p.ShowID = item.ShowID
+		p.Season = item.Season
+		p.Episode = item.Episode
+	}
+
+	return p
+}
+
+// fireFinishedHooks runs "finished" hooks once per torrent,
+// libtorrent reports finish again after recheck or when more files are selected.
+func (s *Service) fireFinishedHooks(t *Torrent) {
+	if item := database.GetStorm().GetBTItem(t.infoHash); item != nil && item.FinishedHookFired {
+		log.Debugf("Finished hooks are already run for %s", t.Name())
+		return
+	}
+
+	if err := database.GetStorm().UpdateBTItemFinishedHook(t.infoHash, true); err != nil {
+		log.Warningf("Could not save finished hooks state for %s: %s", t.Name(), err)
+	}
+	s.fireHooks(t.newHookPayload(HookTorrentFinished))
+}
+
+// fireHooks runs all hooks, subscribed to the event, in background
+func (s *Service) fireHooks(p *HookPayload) {
+	if p == nil {
+		return
+	}
+
+	s.muHooks.Lock()
+	hooks := []*Hook{}
+	for _, h := range s.hooks {
+		for _, e := range h.Events {
+			if e == p.Event {
+				hooks = append(hooks, h)
+				break
+			}
+		}
+	}
+	s.muHooks.Unlock()
+
+	for _, h := range hooks {
+		go s.runHook(h, p)
+	}
+}
+
+func (s *Service) runHook(h *Hook, p *HookPayload) {
+	entry := &HookLogEntry{
+		Time:     time.Now(),
+		Event:    p.Event,
+		InfoHash: p.InfoHash,
+		Name:     p.Name,
+	}
+
+	var err error
+	for attempt := 0; attempt <= h.Retries; attempt++ {
+		if attempt > 0 {
+			select {
+			case <-s.Closer.C():
+				return
+			case <-time.After(time.Duration(attempt) * 5 * time.Second):
+			}
+		}
+
+		entry.Attempts++
+		if h.Command != "" {
+			entry.Output, err = h.runCommand(p)
+		} else {
+			entry.Output, err = h.sendWebhook(p)
+		}
+		if err == nil {
+			break
+		}
+		log.Warningf("Hook %s failed on %s for %s, attempt %d: %s", h.Name, p.Event, p.Name, entry.Attempts, err)
+	}
+
+	entry.Success = err == nil
+	if err != nil {
+		entry.Error = err.Error()
+	}
+	entry.Duration = time.Since(entry.Time).Round(time.Millisecond).String()
+	if len(entry.Output) > hookOutputSize {
+		entry.Output = entry.Output[:hookOutputSize]
+	}
+
+	log.Infof("Hook %s finished on %s for %s, success: %v", h.Name, p.Event, p.Name, entry.Success)
+
+	s.muHooks.Lock()
+	defer s.muHooks.Unlock()
+
+	logs := append(s.hookLogs[h.Name], entry)
+	if len(logs) > hookLogSize {
+		logs = logs[len(logs)-hookLogSize:]
+	}
+	s.hookLogs[h.Name] = logs
+}
+
+func (h *Hook) runCommand(p *HookPayload) (string, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Duration(h.Timeout)*time.Second)
+	defer cancel()
+
+	cmd := exec.CommandContext(ctx, h.Command, h.Args...)
+	cmd.Env = append(os.Environ(),
+		"ELEMENTUM_EVENT="+p.Event,
+		"ELEMENTUM_INFOHASH="+p.InfoHash,
+		"ELEMENTUM_NAME="+p.Name,
+		"ELEMENTUM_SAVE_PATH="+p.SavePath,
+		"ELEMENTUM_CATEGORY="+p.Category,
+		"ELEMENTUM_MEDIA_TYPE="+p.MediaType,
+		"ELEMENTUM_TMDB_ID="+strconv.Itoa(p.TMDBID),
+		"ELEMENTUM_SHOW_ID="+strconv.Itoa(p.ShowID),
+		"ELEMENTUM_SEASON="+strconv.Itoa(p.Season),
+		"ELEMENTUM_EPISODE="+strconv.Itoa(p.Episode),
+		"ELEMENTUM_FILES="+strings.Join(p.Files, string(os.PathListSeparator)),
+	)
+
+	out, err := cmd.CombinedOutput()
+	if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+		return string(out), fmt.Errorf("Timeout after %d seconds", h.Timeout)
+	}
+	return string(out), err
+}
+
+func (h *Hook) sendWebhook(p *HookPayload) (string, error) {
+	body, err := json.Marshal(p)
+	if err != nil {
+		return "", err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Duration(h.Timeout)*time.Second)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, h.URL, bytes.NewReader(body))
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	for k, v := range h.Headers {
+		req.Header.Set(k, v)
+	}
+
+	resp, err := proxy.GetDirectClient().Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+
+	out, _ := io.ReadAll(io.LimitReader(resp.Body, hookOutputSize))
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return string(out), fmt.Errorf("Bad status code: %d", resp.StatusCode)
+	}
+
+	return string(out), nil
+}
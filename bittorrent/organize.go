@@ -0,0 +1,276 @@
+package bittorrent
+
+import (
+	"errors"
+	"fmt"
+	"path"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/elgatito/elementum/config"
+	"github.com/elgatito/elementum/database"
+	"github.com/elgatito/elementum/tmdb"
+	"github.com/elgatito/elementum/tvdb"
+	"github.com/elgatito/elementum/util"
+)
+
+const (
+	// DefaultMovieTemplate is a Kodi-friendly layout for movies
+	DefaultMovieTemplate = "{title} ({year})/{title} ({year}) [{resolution}].{ext}"
+	// DefaultShowTemplate is a Kodi-friendly layout for episodes
+	DefaultShowTemplate = "{show}/Season {season}/{show} - S{season:02}E{episode:02}.{ext}"
+)
+
+var (
+	organizeTokenRegexp = regexp.MustCompile(`\{(\w+)(?::(\d+))?\}`)
+	organizeEmptyRegexp = regexp.MustCompile(`\s*(\[\s*\]|\(\s*\))`)
+	organizeVideoRegexp = regexp.MustCompile(`(?i)\.(mkv|mp4|m4v|avi|mov|wmv|ts|m2ts|webm|mpg|mpeg)$`)
+)
+
+// OrganizedFile is a torrent file with the target path, relative to the destination folder
+type OrganizedFile struct {
+	Index  int    `json:"index"`
+	Path   string `json:"path"`
+	Target string `json:"target"`
+}
+
+// organizeTokens contains values for template tokens, strings or ints
+type organizeTokens map[string]interface{}
+
+// FormatTemplate replaces {token} and {token:02} occurrences in the template.
+// Unknown tokens are left empty, empty brackets are removed.
+func FormatTemplate(template string, tokens map[string]interface{}) string {
+	res := organizeTokenRegexp.ReplaceAllStringFunc(template, func(m string) string {
+		parts := organizeTokenRegexp.FindStringSubmatch(m)
+		switch v := tokens[parts[1]].(type) {
+		case int:
+			if parts[2] != "" {
+				width, _ := strconv.Atoi(parts[2])
+				return fmt.Sprintf("%0*d", width, v)
+			}
+			return strconv.Itoa(v)
+		case string:
+			return util.ToFileName(v)
+		}
+		return ""
+	})
+
+	// Clean every path segment, so that empty tokens do not leave garbage
+	segments := []string{}
+	for _, s := range strings.Split(res, "/") {
+		s = strings.Join(strings.Fields(organizeEmptyRegexp.ReplaceAllString(s, "")), " ")
+		s = strings.Trim(s, " .-")
+		if s != "" {
+			segments = append(segments, s)
+		}
+	}
+
+	return strings.Join(segments, "/")
+}
+
+// OrganizeFiles returns target paths for media files of the torrent,
+// according to TMDB item, assigned to the torrent, and configured templates.
+func (t *Torrent) OrganizeFiles(item *database.BTItem) ([]*OrganizedFile, error) {
+	if item == nil {
+		return nil, errors.New("Torrent is not assigned to any TMDB item")
+	} else if !t.HasMetadata() || len(t.files) == 0 {
+		return nil, errors.New("Torrent has no metadata")
+	}
+
+	videos := []*File{}
+	for _, f := range t.files {
+		if organizeVideoRegexp.MatchString(f.Name) && !strings.Contains(strings.ToLower(f.Path), "sample") {
+			videos = append(videos, f)
+		}
+	}
+	if len(videos) == 0 {
+		return nil, errors.New("No video files in the torrent")
+	}
+
+	var ret []*OrganizedFile
+	var err error
+	switch item.Type {
+	case movieType:
+		ret, err = t.organizeMovie(item, videos)
+	case episodeType, showType:
+		ret, err = t.organizeShow(item, videos)
+	default:
+		err = fmt.Errorf("Unsupported media type: %s", item.Type)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return append(ret, t.organizeSubtitles(ret)...), nil
+}
+
+func (t *Torrent) organizeMovie(item *database.BTItem, videos []*File) ([]*OrganizedFile, error) {
+	movie := tmdb.GetMovie(item.ID, config.Get().Language)
+	if movie == nil {
+		return nil, fmt.Errorf("Unable to find movie %d", item.ID)
+	}
+
+	template := t.Service.config.CompletedMovieTemplate
+	if template == "" {
+		template = DefaultMovieTemplate
+	}
+
+	// Only the main video is renamed, extras keep their names
+	biggest := videos[0]
+	for _, f := range videos {
+		if f.Size > biggest.Size {
+			biggest = f
+		}
+	}
+
+	tokens := t.organizeFileTokens(biggest)
+	tokens["title"] = movie.Title
+	tokens["original_title"] = movie.OriginalTitle
+	tokens["year"] = strings.Split(movie.ReleaseDate, "-")[0]
+	tokens["tmdb"] = movie.ID
+
+	return []*OrganizedFile{{Index: biggest.Index, Path: biggest.Path, Target: formatTarget(template, tokens)}}, nil
+}
+
+func (t *Torrent) organizeShow(item *database.BTItem, videos []*File) ([]*OrganizedFile, error) {
+	showID := item.ShowID
+	if showID == 0 {
+		showID = item.ID
+	}
+	show := tmdb.GetShow(showID, config.Get().Language)
+	if show == nil {
+		return nil, fmt.Errorf("Unable to find show %d", showID)
+	}
+
+	var tvdbShow *tvdb.Show
+	if show.IsAnime() {
+		tvdbID := util.StrInterfaceToInt(show.ExternalIDs.TVDBID)
+		tvdbShow, _ = tvdb.GetShow(tvdbID, config.Get().Language)
+	}
+
+	template := t.Service.config.CompletedShowTemplate
+	if template == "" {
+		template = DefaultShowTemplate
+	}
+
+	choices := make([]*CandidateFile, 0, len(videos))
+	for _, f := range videos {
+		choices = append(choices, &CandidateFile{Index: f.Index, Filename: f.Name, Path: f.Path, Size: f.Size})
+	}
+
+	ret := []*OrganizedFile{}
+	matched := map[int]bool{}
+	for _, season := range show.Seasons {
+		if season == nil || season.EpisodeCount == 0 || (item.Season > 0 && season.Season != item.Season && len(videos) == 1) {
+			continue
+		}
+		tmdbSeason := tmdb.GetSeason(show.ID, season.Season, config.Get().Language, len(show.Seasons), true)
+		if tmdbSeason == nil {
+			continue
+		}
+
+		for _, episode := range tmdbSeason.Episodes {
+			if episode == nil {
+				continue
+			}
+
+			index, found := MatchEpisodeFilename(season.Season, episode.EpisodeNumber, show.CountRealSeasons() == 1, item.Season, show, episode, tvdbShow, choices)
+			if index < 0 || found != 1 || matched[choices[index].Index] {
+				continue
+			}
+			f := t.GetFileByIndex(choices[index].Index)
+			if f == nil {
+				continue
+			}
+			matched[f.Index] = true
+
+			tokens := t.organizeFileTokens(f)
+			tokens["show"] = show.Name
+			tokens["original_show"] = show.OriginalName
+			tokens["year"] = strings.Split(show.FirstAirDate, "-")[0]
+			tokens["tmdb"] = show.ID
+			tokens["season"] = season.Season
+			tokens["episode"] = episode.EpisodeNumber
+			tokens["episode_title"] = episode.Name
+
+			ret = append(ret, &OrganizedFile{Index: f.Index, Path: f.Path, Target: formatTarget(template, tokens)})
+		}
+	}
+
+	if len(ret) == 0 {
+		return nil, errors.New("Unable to match any episode in the torrent")
+	}
+	return ret, nil
+}
+
+// organizeSubtitles makes subtitles, named after organized videos, follow them
+func (t *Torrent) organizeSubtitles(videos []*OrganizedFile) []*OrganizedFile {
+	ret := []*OrganizedFile{}
+	for _, v := range videos {
+		base := util.FileWithoutExtension(v.Path)
+		target := util.FileWithoutExtension(v.Target)
+
+		for _, f := range t.files {
+			if !util.HasSubtitlesExt(f.Name) || !strings.HasPrefix(f.Path, base) {
+				continue
+			}
+
+			// Keep language suffix, like "movie.en.srt"
+			ret = append(ret, &OrganizedFile{Index: f.Index, Path: f.Path, Target: target + strings.TrimPrefix(f.Path, base)})
+		}
+	}
+
+	return ret
+}
+
+func (t *Torrent) organizeFileTokens(f *File) organizeTokens {
+	tokens := organizeTokens{
+		"name": util.FileWithoutExtension(f.Name),
+		"ext":  strings.TrimPrefix(filepath.Ext(f.Name), "."),
+	}
+
+	tf := &TorrentFile{Name: " " + t.Name() + " " + f.Name + " "}
+	if res := matchLowerTags(tf, resolutionTags); res > 0 && res < len(Resolutions) {
+		tokens["resolution"] = Resolutions[res]
+	}
+
+	return tokens
+}
+
+func formatTarget(template string, tokens organizeTokens) string {
+	if !strings.Contains(template, "{ext}") {
+		template += ".{ext}"
+	}
+
+	return FormatTemplate(template, tokens)
+}
+
+// RenameFiles renames files inside of the torrent, so it keeps seeding with new names
+func (t *Torrent) RenameFiles(files []*OrganizedFile) error {
+	if t.th == nil || t.th.Swigcptr() == 0 {
+		return errors.New("Torrent is not available")
+	} else if t.PlayerAttached > 0 {
+		return errors.New("Torrent is being played")
+	}
+
+	prefix := ""
+	if t.ti != nil && t.ti.NumFiles() > 1 {
+		// Multi-file torrents keep files inside of torrent folder
+		prefix = t.ti.Name()
+	}
+
+	for _, f := range files {
+		target := path.Join(prefix, f.Target)
+		if target == f.Path {
+			continue
+		}
+
+		log.Infof("Renaming %s to %s in torrent %s", f.Path, target, t.Name())
+		t.th.RenameFile(f.Index, target)
+	}
+
+	t.IsRenamed = true
+	return nil
+}
@@ -12,6 +12,7 @@ import (
 	"sort"
 	"strconv"
 	"strings"
+	"sync"
 	"time"
 
 	lt "github.com/ElementumOrg/libtorrent-go"
@@ -78,6 +79,13 @@ type Player struct {
 	notEnoughSpace       bool
 	bufferEvents         *broadcast.Broadcaster
 
+	fallback         FallbackFunc
+	fallbackTried    map[string]bool
+	muFallback       sync.Mutex
+	addedTorrent     bool
+	bufferStallCheck time.Time
+	bufferStallLast  float64
+
 	closer event.Event
 	closed bool
 }
@@ -173,6 +181,11 @@ func (btp *Player) SetTorrent(t *Torrent) {
 
 	btp.t = t
 
+	// Torrent with a player should not wait in the queue
+	if t.IsQueued {
+		go btp.s.UpdateQueue()
+	}
+
 	btp.t.IsBuffering = false
 	btp.t.IsBufferingFinished = false
 	btp.t.IsNextFile = false
@@ -195,6 +208,7 @@ func (btp *Player) addTorrent() error {
 		}
 
 		btp.SetTorrent(torrent)
+		btp.addedTorrent = true
 	}
 	if btp.t == nil || btp.t.th == nil {
 		return fmt.Errorf("Unable to add torrent with URI %s", btp.p.URI)
@@ -552,6 +566,16 @@ func (btp *Player) bufferDialog() {
 	oneSecond := time.NewTicker(1 * time.Second)
 	defer oneSecond.Stop()
 
+	// Alternative release is searched in background, to keep cancel responsive
+	var fallback chan fallbackResult
+	defer func() {
+		if fallback != nil {
+			go func(fallback chan fallbackResult) {
+				btp.dropFallback(<-fallback)
+			}(fallback)
+		}
+	}()
+
 	for {
 		select {
 		case <-halfSecond.C:
@@ -567,7 +591,22 @@ func (btp *Player) bufferDialog() {
 				btp.t.ResetBuffering()
 				return
 			}
+		case result := <-fallback:
+			fallback = nil
+			if result.err != nil {
+				log.Warningf("Could not replace stalled torrent: %s", result.err)
+				if errors.Is(result.err, errNoFallback) {
+					btp.fallback = nil
+				}
+				break
+			}
+
+			btp.replaceStalledTorrent(result)
 		case <-oneSecond.C:
+			if fallback == nil && btp.isBufferStalled() {
+				fallback = btp.startFallback()
+			}
+
 			if finished, err := btp.updateBufferDialog(); finished {
 				return
 			} else if err != nil {
@@ -610,8 +649,8 @@ func (btp *Player) updateBufferDialog() (bool, error) {
 				return false, fmt.Errorf("File not chosen")
 			}
 
-			archivePath := filepath.Join(btp.s.config.DownloadPath, btp.chosenFile.Path)
-			destPath := filepath.Join(btp.s.config.DownloadPath, filepath.Dir(btp.chosenFile.Path), "extracted")
+			archivePath := filepath.Join(btp.t.GetSavePath(), btp.chosenFile.Path)
+			destPath := filepath.Join(btp.t.GetSavePath(), filepath.Dir(btp.chosenFile.Path), "extracted")
 
 			if _, err := os.Stat(destPath); err == nil {
 				btp.findExtracted(destPath)
@@ -877,6 +916,10 @@ func (btp *Player) UpdateWatched() {
 
 	// Update Watched state for current file
 	SetWatchedFile(btp.chosenFile.Path, btp.chosenFile.Size, btp.IsWatched())
+	if btp.IsWatched() && btp.t != nil && !btp.t.IsMemoryStorage() && !btp.t.IsPreview {
+		// Cleanup policy removes least recently watched torrents first
+		database.GetStorm().UpdateBTItemWatched(btp.t.InfoHash(), time.Now())
+	}
 
 	if btp.IsWatched() {
 		var watched *trakt.WatchedItem
@@ -1014,19 +1057,23 @@ func (btp *Player) setRateLimiting(enable bool) {
 	if btp.s.config.LimitAfterBuffering {
 		settings := btp.s.PackSettings
 		if enable {
-			if btp.s.config.DownloadRateLimit > 0 {
-				log.Infof("Buffer filled, rate limiting download to %s", humanize.Bytes(uint64(btp.s.config.DownloadRateLimit)))
-				settings.SetInt("download_rate_limit", btp.s.config.UploadRateLimit)
+			// Limits can come from scheduled bandwidth profile
+			downloadLimit, uploadLimit := btp.s.GetRateLimits()
+			if downloadLimit > 0 {
+				log.Infof("Buffer filled, rate limiting download to %s", humanize.Bytes(uint64(downloadLimit)))
+				settings.SetInt("download_rate_limit", downloadLimit)
 			}
-			if btp.s.config.UploadRateLimit > 0 {
+			if uploadLimit > 0 {
 				// If we have an upload rate, use the nicer bittyrant choker
-				log.Infof("Buffer filled, rate limiting upload to %s", humanize.Bytes(uint64(btp.s.config.UploadRateLimit)))
-				settings.SetInt("upload_rate_limit", btp.s.config.UploadRateLimit)
+				log.Infof("Buffer filled, rate limiting upload to %s", humanize.Bytes(uint64(uploadLimit)))
+				settings.SetInt("upload_rate_limit", uploadLimit)
 			}
 		} else {
-			log.Info("Resetting rate limiting")
-			settings.SetInt("download_rate_limit", 0)
-			settings.SetInt("upload_rate_limit", 0)
+			// Data-cap throttling stays, it does not depend on playback
+			downloadLimit, uploadLimit := btp.s.quotaRateLimits()
+			log.Infof("Resetting rate limiting, data-cap limits: download %s/s, upload %s/s", humanize.Bytes(uint64(downloadLimit)), humanize.Bytes(uint64(uploadLimit)))
+			settings.SetInt("download_rate_limit", downloadLimit)
+			settings.SetInt("upload_rate_limit", uploadLimit)
 		}
 		btp.s.Session.ApplySettings(settings)
 	}
@@ -0,0 +1,235 @@
+package bittorrent
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/elgatito/elementum/config"
+	"github.com/elgatito/elementum/tmdb"
+	"github.com/elgatito/elementum/tvdb"
+	"github.com/elgatito/elementum/util"
+)
+
+var (
+	playlistAudioRegexp  = regexp.MustCompile(`(?i)\.(mp3|flac|m4a|aac|ogg|opus|wav|wma)$`)
+	playlistNumberRegexp = regexp.MustCompile(`\d+|\D+`)
+)
+
+// Playlist is listed by DLNA clients on each browse, episodes matching is expensive
+const playlistCacheTTL = 5 * time.Minute
+
+// PlaylistItem is a playable torrent file with a title
+type PlaylistItem struct {
+	File  *File
+	Title string
+}
+
+// Playlist returns playable files of the torrent in natural order,
+// episodes of assigned show go first, in the order of seasons and episodes.
+func (t *Torrent) Playlist() ([]*PlaylistItem, error) {
+	if !t.HasMetadata() || len(t.files) == 0 {
+		return nil, errors.New("Torrent has no metadata")
+	}
+
+	key := ""
+	if item := t.DBItem; item != nil {
+		key = fmt.Sprintf("%s_%d_%d_%d", item.Type, item.ID, item.ShowID, item.Season)
+	}
+
+	t.muPlaylist.Lock()
+	defer t.muPlaylist.Unlock()
+
+	if t.playlist != nil && t.playlistKey == key && time.Since(t.playlistUpdated) < playlistCacheTTL {
+		return t.playlist, nil
+	}
+
+	ret, err := t.makePlaylist()
+	if err != nil {
+		return nil, err
+	}
+
+	t.playlist = ret
+	t.playlistKey = key
+	t.playlistUpdated = time.Now()
+	return ret, nil
+}
+
+// resetPlaylist drops cached playlist, since files were changed
+func (t *Torrent) resetPlaylist() {
+	t.muPlaylist.Lock()
+	defer t.muPlaylist.Unlock()
+
+	t.playlist = nil
+}
+
+func (t *Torrent) makePlaylist() ([]*PlaylistItem, error) {
+	files := []*File{}
+	for _, f := range t.files {
+		if (organizeVideoRegexp.MatchString(f.Name) || playlistAudioRegexp.MatchString(f.Name)) && !strings.Contains(strings.ToLower(f.Path), "sample") {
+			files = append(files, f)
+		}
+	}
+	if len(files) == 0 {
+		return nil, errors.New("No playable files in the torrent")
+	}
+
+	sort.SliceStable(files, func(i, j int) bool {
+		return naturalLess(files[i].Path, files[j].Path)
+	})
+
+	ret := []*PlaylistItem{}
+	if item := t.DBItem; item != nil {
+		switch item.Type {
+		case movieType:
+			ret = t.playlistMovie(item.ID, files)
+		case showType, episodeType:
+			ret = t.playlistShow(item.ShowID, item.Season, files)
+		}
+	}
+
+	added := map[int]bool{}
+	for _, i := range ret {
+		added[i.File.Index] = true
+	}
+	for _, f := range files {
+		if !added[f.Index] {
+			ret = append(ret, &PlaylistItem{File: f, Title: util.FileWithoutExtension(f.Name)})
+		}
+	}
+
+	return ret, nil
+}
+
+func (t *Torrent) playlistMovie(tmdbID int, files []*File) []*PlaylistItem {
+	movie := tmdb.GetMovie(tmdbID, config.Get().Language)
+	if movie == nil {
+		return nil
+	}
+
+	biggest := files[0]
+	for _, f := range files {
+		if f.Size > biggest.Size {
+			biggest = f
+		}
+	}
+
+	return []*PlaylistItem{{File: biggest, Title: fmt.Sprintf("%s (%d)", movie.Title, movie.Year())}}
+}
+
+// playlistShow matches files with episodes, loose matching by episode number is used only for the torrent season
+func (t *Torrent) playlistShow(showID, activeSeason int, files []*File) []*PlaylistItem {
+	show := tmdb.GetShow(showID, config.Get().Language)
+	if show == nil {
+		return nil
+	}
+
+	var tvdbShow *tvdb.Show
+	if show.IsAnime() {
+		tvdbID := util.StrInterfaceToInt(show.ExternalIDs.TVDBID)
+		tvdbShow, _ = tvdb.GetShow(tvdbID, config.Get().Language)
+	}
+
+	choices := make([]*CandidateFile, 0, len(files))
+	for _, f := range files {
+		choices = append(choices, &CandidateFile{Index: f.Index, Filename: f.Name, Path: f.Path, Size: f.Size})
+	}
+
+	// Specials go last, so their loose matches do not take files of regular episodes
+	seasons := make([]*tmdb.Season, 0, len(show.Seasons))
+	for _, season := range show.Seasons {
+		if season != nil && season.EpisodeCount > 0 && season.Season > 0 {
+			seasons = append(seasons, season)
+		}
+	}
+	for _, season := range show.Seasons {
+		if season != nil && season.EpisodeCount > 0 && season.Season == 0 {
+			seasons = append(seasons, season)
+		}
+	}
+
+	ret := []*PlaylistItem{}
+	matched := map[int]bool{}
+	for _, season := range seasons {
+		tmdbSeason := tmdb.GetSeason(show.ID, season.Season, config.Get().Language, len(show.Seasons), true)
+		if tmdbSeason == nil {
+			continue
+		}
+
+		for _, episode := range tmdbSeason.Episodes {
+			if episode == nil {
+				continue
+			}
+
+			index, found := MatchEpisodeFilename(season.Season, episode.EpisodeNumber, show.CountRealSeasons() == 1, activeSeason, show, episode, tvdbShow, choices)
+			if index < 0 || found != 1 || matched[choices[index].Index] {
+				continue
+			}
+			f := t.GetFileByIndex(choices[index].Index)
+			if f == nil {
+				continue
+			}
+			matched[f.Index] = true
+
+			ret = append(ret, &PlaylistItem{File: f, Title: fmt.Sprintf("%s - S%02dE%02d - %s", show.Name, season.Season, episode.EpisodeNumber, episode.Name)})
+		}
+	}
+
+	return ret
+}
+
+// naturalLess compares strings with numbers by their values, so "2" goes before "10"
+func naturalLess(a, b string) bool {
+	pa := playlistNumberRegexp.FindAllString(strings.ToLower(a), -1)
+	pb := playlistNumberRegexp.FindAllString(strings.ToLower(b), -1)
+
+	for i := 0; i < len(pa) && i < len(pb); i++ {
+		if pa[i] == pb[i] {
+			continue
+		}
+
+		na, errA := strconv.Atoi(pa[i])
+		nb, errB := strconv.Atoi(pb[i])
+		if errA == nil && errB == nil && na != nb {
+			return na < nb
+		}
+		return pa[i] < pb[i]
+	}
+
+	return len(pa) < len(pb)
+}
+
+// PlaylistFile returns the biggest playable file of the torrent,
+// or the file of an episode, if season and episode are set.
+func (t *Torrent) PlaylistFile(season, episode int) *File {
+	items, err := t.Playlist()
+	if err != nil {
+		return nil
+	}
+
+	var re *regexp.Regexp
+	if season > 0 && episode > 0 {
+		re = regexp.MustCompile(fmt.Sprintf(episodeMatchRegex, season, episode))
+	}
+
+	var ret *File
+	for _, i := range items {
+		if re != nil && !re.MatchString(i.File.Name) {
+			continue
+		}
+		if ret == nil || i.File.Size > ret.Size {
+			ret = i.File
+		}
+	}
+
+	// Torrent, added for this episode, could have files without episode numbers
+	if ret == nil && re != nil && t.DBItem != nil && t.DBItem.Season == season && t.DBItem.Episode == episode {
+		return t.PlaylistFile(0, 0)
+	}
+
+	return ret
+}
@@ -0,0 +1,176 @@
+package bittorrent
+
+import (
+	"errors"
+	"regexp"
+	"sort"
+	"strconv"
+	"time"
+
+	lt "github.com/ElementumOrg/libtorrent-go"
+
+	"github.com/elgatito/elementum/config"
+)
+
+// previewKeepDuration is how long preview torrent is kept in the session,
+// so that following preview or add of the same torrent does not fetch metadata again.
+const previewKeepDuration = 5 * time.Minute
+
+// previewRemoveTimeout limits waiting for libtorrent to remove preview torrent
+const previewRemoveTimeout = 10 * time.Second
+
+var previewEpisodeRegexps = []*regexp.Regexp{
+	regexp.MustCompile(`(?i)(?:^|\W|_)S(\d{1,3})[\W_]?E(\d{1,4})(?:\W|_|$)`),
+	regexp.MustCompile(`(?i)(?:^|\W|_)(\d{1,2})x(\d{1,3})(?:\W|_|$)`),
+}
+
+// TorrentPreview describes torrent contents, fetched without downloading payload
+type TorrentPreview struct {
+	InfoHash  string         `json:"infohash"`
+	Name      string         `json:"name"`
+	TotalSize int64          `json:"total_size"`
+	Files     []*PreviewFile `json:"files"`
+}
+
+// PreviewFile is a file inside of previewed torrent, with detected season/episode if any
+type PreviewFile struct {
+	Index   int    `json:"index"`
+	Path    string `json:"path"`
+	Name    string `json:"name"`
+	Size    int64  `json:"size"`
+	Season  int    `json:"season,omitempty"`
+	Episode int    `json:"episode,omitempty"`
+}
+
+// PreviewTorrent fetches torrent metadata and returns list of files.
+// Torrent is added in upload mode, without selected files, so no payload is downloaded,
+// and is dropped from the session right away or after a short delay if keep is set.
+func (s *Service) PreviewTorrent(uri string, keep bool) (*TorrentPreview, error) {
+	torrent := NewTorrentFile(uri)
+	if err := torrent.Resolve(); err == nil && torrent.InfoHash != "" {
+		if t := s.q.FindByHash(torrent.InfoHash); t != nil && t.HasMetadata() {
+			if t.IsPreview {
+				s.schedulePreviewDrop(t, keep)
+			}
+			return t.Preview(), nil
+		}
+	}
+
+	t, err := s.AddTorrent(nil, AddOptions{URI: uri, Paused: false, DownloadStorage: config.StorageFile, FirstTime: false, AddedTime: time.Now(), Preview: true})
+	if err != nil {
+		return nil, err
+	} else if t == nil || !t.HasMetadata() {
+		return nil, errors.New("Could not fetch torrent metadata")
+	}
+
+	preview := t.Preview()
+	if t.IsPreview {
+		s.schedulePreviewDrop(t, keep)
+	}
+
+	return preview, nil
+}
+
+// Preview returns torrent files list
+func (t *Torrent) Preview() *TorrentPreview {
+	ret := &TorrentPreview{
+		InfoHash: t.InfoHash(),
+		Name:     t.Name(),
+		Files:    []*PreviewFile{},
+	}
+
+	for _, f := range t.files {
+		pf := &PreviewFile{
+			Index: f.Index,
+			Path:  f.Path,
+			Name:  f.Name,
+			Size:  f.Size,
+		}
+		pf.Season, pf.Episode = detectEpisode(f.Name)
+
+		ret.TotalSize += f.Size
+		ret.Files = append(ret.Files, pf)
+	}
+
+	sort.Slice(ret.Files, func(i, j int) bool {
+		return ret.Files[i].Path < ret.Files[j].Path
+	})
+	return ret
+}
+
+func (s *Service) schedulePreviewDrop(t *Torrent, keep bool) {
+	if !keep {
+		s.dropPreview(t)
+		return
+	}
+
+	s.muPreview.Lock()
+	defer s.muPreview.Unlock()
+
+	if s.previewTimers == nil {
+		s.previewTimers = map[string]*time.Timer{}
+	}
+	if timer, ok := s.previewTimers[t.infoHash]; ok {
+		timer.Stop()
+	}
+
+	s.previewTimers[t.infoHash] = time.AfterFunc(previewKeepDuration, func() {
+		s.dropPreview(t)
+	})
+}
+
+// dropPreview removes preview torrent from the session, downloaded data is never touched.
+// Waits until libtorrent has removed it, so the same torrent can be added right after.
+func (s *Service) dropPreview(t *Torrent) {
+	s.muPreview.Lock()
+	if timer, ok := s.previewTimers[t.infoHash]; ok {
+		timer.Stop()
+		delete(s.previewTimers, t.infoHash)
+	}
+	s.muPreview.Unlock()
+
+	if !t.IsPreview || !s.q.Delete(t) {
+		return
+	}
+
+	log.Infof("Dropping preview torrent %s", t.Name())
+	t.Closer.Set()
+
+	alerts, done := s.Alerts()
+	defer close(done)
+
+	if err := s.Session.RemoveTorrent(t.th, 0); err != nil {
+		log.Errorf("Could not remove preview torrent: %s", err)
+		return
+	}
+
+	timeout := time.After(previewRemoveTimeout)
+	for {
+		select {
+		case <-timeout:
+			log.Warningf("Preview torrent %s is not removed in time", t.infoHash)
+			return
+
+		case alert, ok := <-alerts:
+			if !ok {
+				return
+			}
+			if alert.Type == lt.TorrentRemovedAlertAlertType && alert.InfoHash == t.infoHash {
+				return
+			}
+		}
+	}
+}
+
+// detectEpisode looks for season and episode numbers in the file name
+func detectEpisode(name string) (season, episode int) {
+	for _, re := range previewEpisodeRegexps {
+		if m := re.FindStringSubmatch(name); len(m) == 3 {
+			season, _ = strconv.Atoi(m[1])
+			episode, _ = strconv.Atoi(m[2])
+			return
+		}
+	}
+
+	return
+}
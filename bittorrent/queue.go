@@ -1,16 +1,27 @@
 package bittorrent
 
-// Queue represents list of torrents inside of a session
+import (
+	"math"
+	"sort"
+
+	"github.com/anacrolix/sync"
+
+	"github.com/elgatito/elementum/database"
+)
+
+// Queue represents ordered list of torrents inside of a session
 type Queue struct {
 	s        *Service
+	mu       sync.RWMutex
+	updateMu sync.Mutex
 	torrents []*Torrent
 }
 
 // NewQueue contructor for empty Queue
 func NewQueue(s *Service) *Queue {
 	return &Queue{
-		s,
-		[]*Torrent{},
+		s:        s,
+		torrents: []*Torrent{},
 	}
 }
 
@@ -20,20 +31,19 @@ func (q *Queue) Add(t *Torrent) bool {
 		return false
 	}
 
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
 	q.torrents = append(q.torrents, t)
 	return true
 }
 
 // Delete removes torrent from the queue
 func (q *Queue) Delete(t *Torrent) bool {
-	idx := -1
-	for i, ti := range q.torrents {
-		if ti.InfoHash() == t.InfoHash() {
-			idx = i
-			break
-		}
-	}
+	q.mu.Lock()
+	defer q.mu.Unlock()
 
+	idx := q.indexOf(t)
 	if idx < 0 {
 		return false
 	}
@@ -44,11 +54,19 @@ func (q *Queue) Delete(t *Torrent) bool {
 
 // All returns all queue
 func (q *Queue) All() []*Torrent {
-	return q.torrents
+	q.mu.RLock()
+	defer q.mu.RUnlock()
+
+	ret := make([]*Torrent, len(q.torrents))
+	copy(ret, q.torrents)
+	return ret
 }
 
 // FindByHash checks if torrent with infohash is in the queue
 func (q *Queue) FindByHash(hash string) *Torrent {
+	q.mu.RLock()
+	defer q.mu.RUnlock()
+
 	for _, t := range q.torrents {
 		if t.InfoHash() == hash {
 			return t
@@ -60,6 +78,9 @@ func (q *Queue) FindByHash(hash string) *Torrent {
 
 // FindByURI checks if torrent with infohash is in the queue
 func (q *Queue) FindByURI(uri string) *Torrent {
+	q.mu.RLock()
+	defer q.mu.RUnlock()
+
 	for _, t := range q.torrents {
 		if t.torrentFile == uri {
 			return t
@@ -72,5 +93,137 @@ func (q *Queue) FindByURI(uri string) *Torrent {
 // Clean would cleanup torrents list,
 // should be used in case of a service reload
 func (q *Queue) Clean() {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
 	q.torrents = []*Torrent{}
 }
+
+// Position returns 1-based position of the torrent in the queue, or 0 if it is not found
+func (q *Queue) Position(t *Torrent) int {
+	q.mu.RLock()
+	defer q.mu.RUnlock()
+
+	return q.indexOf(t) + 1
+}
+
+// Move changes torrent position in the queue and saves new order
+func (q *Queue) Move(t *Torrent, direction int) bool {
+	q.mu.Lock()
+
+	idx := q.indexOf(t)
+	if idx < 0 {
+		q.mu.Unlock()
+		return false
+	}
+
+	newIdx := idx
+	switch direction {
+	case QueueUp:
+		newIdx = idx - 1
+	case QueueDown:
+		newIdx = idx + 1
+	case QueueTop:
+		newIdx = 0
+	case QueueBottom:
+		newIdx = len(q.torrents) - 1
+	}
+	if newIdx < 0 || newIdx >= len(q.torrents) || newIdx == idx {
+		q.mu.Unlock()
+		return false
+	}
+
+	q.torrents = append(q.torrents[:idx], q.torrents[idx+1:]...)
+	q.torrents = append(q.torrents[:newIdx], append([]*Torrent{t}, q.torrents[newIdx:]...)...)
+	q.mu.Unlock()
+
+	q.Save()
+	return true
+}
+
+// Save stores current positions into the database
+func (q *Queue) Save() {
+	for i, t := range q.All() {
+		database.GetStorm().UpdateBTItemQueuePosition(t.InfoHash(), i+1)
+		if t.DBItem != nil {
+			t.DBItem.QueuePosition = i + 1
+		}
+	}
+}
+
+// Sort restores saved positions, torrents without saved position keep their order at the end
+func (q *Queue) Sort() {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	position := func(t *Torrent) int {
+		if t.DBItem == nil || t.DBItem.QueuePosition <= 0 {
+			return math.MaxInt32
+		}
+		return t.DBItem.QueuePosition
+	}
+
+	sort.SliceStable(q.torrents, func(i, j int) bool {
+		return position(q.torrents[i]) < position(q.torrents[j])
+	})
+}
+
+// MoveInQueue changes torrent position in the session queue
+func (s *Service) MoveInQueue(t *Torrent, direction int) bool {
+	return s.q.Move(t, direction)
+}
+
+// UpdateQueue starts and stops torrents to fit into active downloads/seeds limits.
+// Torrents with attached player are always active and take the slots first,
+// torrents paused by user or by seeding limits are not managed by the queue.
+func (s *Service) UpdateQueue() {
+	if s.Closer.IsSet() {
+		return
+	}
+
+	s.q.updateMu.Lock()
+	defer s.q.updateMu.Unlock()
+
+	maxDownloads := s.config.MaxActiveDownloads
+	maxSeeds := s.config.MaxActiveSeeds
+
+	torrents := s.q.All()
+	sort.SliceStable(torrents, func(i, j int) bool {
+		return torrents[i].PlayerAttached > 0 && torrents[j].PlayerAttached <= 0
+	})
+
+	downloads := 0
+	seeds := 0
+	for _, t := range torrents {
+		if t.Closer.IsSet() || t.IsMemoryStorage() || t.IsPreview || !t.HasMetadata() {
+			continue
+		}
+		if !t.IsQueued && (t.IsPaused || t.GetPaused()) {
+			continue
+		}
+
+		limit, active := maxDownloads, &downloads
+		if t.GetProgress() >= 100 {
+			limit, active = maxSeeds, &seeds
+		}
+
+		if t.PlayerAttached > 0 || limit <= 0 || *active < limit {
+			*active++
+			if t.IsQueued {
+				t.unqueue()
+			}
+		} else if !t.IsQueued {
+			t.queue()
+		}
+	}
+}
+
+func (q *Queue) indexOf(t *Torrent) int {
+	for i, ti := range q.torrents {
+		if ti == t {
+			return i
+		}
+	}
+
+	return -1
+}
@@ -0,0 +1,199 @@
+package bittorrent
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/dustin/go-humanize"
+
+	"github.com/elgatito/elementum/config"
+	"github.com/elgatito/elementum/database"
+	"github.com/elgatito/elementum/util"
+	"github.com/elgatito/elementum/xbmc"
+)
+
+const (
+	// QuotaMonthly resets usage every month on configured day
+	QuotaMonthly = iota
+	// QuotaRolling counts usage for configured number of last days
+	QuotaRolling
+)
+
+// QuotaStatus is data-cap usage for current period, quotas of 0 mean unlimited
+type QuotaStatus struct {
+	Enabled       bool      `json:"enabled"`
+	Start         time.Time `json:"start"`
+	Downloaded    int64     `json:"downloaded"`
+	Uploaded      int64     `json:"uploaded"`
+	DownloadQuota int64     `json:"download_quota"`
+	UploadQuota   int64     `json:"upload_quota"`
+	Throttled     bool      `json:"throttled"`
+	Exceeded      bool      `json:"exceeded"`
+	Paused        []string  `json:"paused"`
+}
+
+// quotaStart returns the first day of current quota period
+func quotaStart(conf *config.Configuration, now time.Time) time.Time {
+	today := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, now.Location())
+
+	if conf.QuotaMode == QuotaRolling {
+		window := conf.QuotaWindow
+		if window <= 0 {
+			window = 30
+		}
+		return today.AddDate(0, 0, -(window - 1))
+	}
+
+	// Reset day is limited to 28, so that it exists in every month
+	day := conf.QuotaResetDay
+	if day < 1 {
+		day = 1
+	} else if day > 28 {
+		day = 28
+	}
+
+	start := time.Date(now.Year(), now.Month(), day, 0, 0, 0, 0, now.Location())
+	if start.After(today) {
+		start = start.AddDate(0, -1, 0)
+	}
+	return start
+}
+
+// GetQuotaStatus returns data-cap usage for current period
+func (s *Service) GetQuotaStatus() *QuotaStatus {
+	s.muQuota.Lock()
+	defer s.muQuota.Unlock()
+
+	if s.quota == nil {
+		return &QuotaStatus{Paused: []string{}}
+	}
+
+	ret := *s.quota
+	return &ret
+}
+
+// quotaRateLimits returns limits in bytes/s, applied while usage is close to the quota
+func (s *Service) quotaRateLimits() (downloadLimit, uploadLimit int) {
+	s.muQuota.Lock()
+	defer s.muQuota.Unlock()
+
+	return s.quotaDownloadLimit, s.quotaUploadLimit
+}
+
+// checkQuota throttles session when usage is close to the quota,
+// and pauses torrents, that are not played, when the quota is exceeded.
+func (s *Service) checkQuota() {
+	conf := s.config
+
+	s.muQuota.Lock()
+	state := s.quotaState
+	s.muQuota.Unlock()
+	if state == nil {
+		state = database.GetStorm().GetQuotaState()
+	}
+
+	status := &QuotaStatus{
+		Enabled:       conf.QuotaEnabled && (conf.QuotaDownload > 0 || conf.QuotaUpload > 0),
+		DownloadQuota: conf.QuotaDownload,
+		UploadQuota:   conf.QuotaUpload,
+		Paused:        []string{},
+	}
+
+	downloadLimit, uploadLimit := 0, 0
+	if status.Enabled {
+		status.Start = quotaStart(conf, time.Now())
+
+		var err error
+		status.Downloaded, status.Uploaded, err = database.GetStorm().GetTransferStatsSince(status.Start.Format(database.TransferStatsDayFormat))
+		if err != nil {
+			log.Warningf("Could not get quota usage: %s", err)
+			return
+		}
+
+		isClose := func(used, quota int64) bool {
+			return quota > 0 && conf.QuotaThrottlePercent > 0 && used >= quota*int64(conf.QuotaThrottlePercent)/100
+		}
+		if isClose(status.Downloaded, status.DownloadQuota) && conf.QuotaThrottleRate > 0 {
+			downloadLimit = conf.QuotaThrottleRate
+		}
+		if isClose(status.Uploaded, status.UploadQuota) && conf.QuotaThrottleRate > 0 {
+			uploadLimit = conf.QuotaThrottleRate
+		}
+		status.Throttled = downloadLimit > 0 || uploadLimit > 0
+
+		status.Exceeded = (status.DownloadQuota > 0 && status.Downloaded >= status.DownloadQuota) ||
+			(status.UploadQuota > 0 && status.Uploaded >= status.UploadQuota)
+	}
+
+	period := status.Start.Format(database.TransferStatsDayFormat)
+	if state.Period != period {
+		state.Period = period
+		state.Notified = false
+	}
+
+	if status.Exceeded {
+		for _, t := range s.GetTorrents() {
+			if t == nil || t.Closer.IsSet() || t.IsPreview || t.PlayerAttached > 0 || t.IsBuffering || t.IsPaused {
+				continue
+			}
+
+			log.Infof("Pausing %s, data-cap quota is exceeded", t.Name())
+			t.Pause()
+			// Torrent could be resumed by the user after it was paused
+			if hash := t.InfoHash(); !util.StringSliceContains(state.Paused, hash) {
+				state.Paused = append(state.Paused, hash)
+			}
+		}
+
+		if !state.Notified {
+			state.Notified = true
+			log.Warningf("Data-cap quota is exceeded: downloaded %s, uploaded %s since %s", humanize.Bytes(uint64(status.Downloaded)), humanize.Bytes(uint64(status.Uploaded)), period)
+			if xbmcHost, err := xbmc.GetLocalXBMCHost(); xbmcHost != nil && err == nil {
+				xbmcHost.Notify("Elementum", fmt.Sprintf("LOCALIZE[30753];;%d", len(state.Paused)), config.AddonIcon())
+			}
+		}
+	} else if len(state.Paused) > 0 {
+		for _, hash := range state.Paused {
+			if t := s.GetTorrentByHash(hash); t != nil && t.IsPaused {
+				log.Infof("Resuming %s, data-cap quota is no longer exceeded", t.Name())
+				t.Resume()
+			}
+		}
+		state.Paused = nil
+		go s.UpdateQueue()
+	}
+	status.Paused = append(status.Paused, state.Paused...)
+
+	// While disk space is critical, state is only kept in memory until next checks
+	if !database.WritesSuspended() {
+		if err := database.GetStorm().SetQuotaState(state); err != nil {
+			log.Warningf("Could not save quota state: %s", err)
+		}
+	}
+
+	s.muQuota.Lock()
+	changed := s.quotaDownloadLimit != downloadLimit || s.quotaUploadLimit != uploadLimit
+	s.quotaDownloadLimit, s.quotaUploadLimit = downloadLimit, uploadLimit
+	s.quota = status
+	s.quotaState = state
+	s.muQuota.Unlock()
+
+	if changed {
+		log.Infof("Data-cap throttling changed to download %s/s, upload %s/s", humanize.Bytes(uint64(downloadLimit)), humanize.Bytes(uint64(uploadLimit)))
+
+		// Same as with scheduled profiles, with "limit after buffering" player restores limits after buffering,
+		// until then only quota throttling is applied.
+		if !s.config.LimitAfterBuffering || s.hasBufferedPlayer() {
+			s.RestoreLimits()
+		} else if !s.IsBuffering() {
+			s.restoreQuotaLimits()
+		}
+	}
+}
+
+// restoreQuotaLimits applies only quota throttling, for the session, that is otherwise unlimited
+func (s *Service) restoreQuotaLimits() {
+	downloadLimit, uploadLimit := s.quotaRateLimits()
+	s.SetDownloadLimit(downloadLimit)
+	s.SetUploadLimit(uploadLimit)
+}
@@ -0,0 +1,159 @@
+package bittorrent
+
+import (
+	"sync"
+	"time"
+
+	"github.com/elgatito/elementum/config"
+)
+
+const (
+	readRateWindow = 2 * time.Second
+	readRateIdle   = 10 * time.Second
+	readRateWeight = 0.3
+
+	// Player fills own cache much faster than playback goes,
+	// so consumption rate grows readahead only up to this multiple of bitrate.
+	maxRateToBitrate = 4
+
+	// Readahead is changed only if the difference is bigger than that
+	readaheadThreshold = 0.25
+)
+
+// readRate tracks how fast the reader consumes the file
+type readRate struct {
+	mu sync.Mutex
+
+	start time.Time
+	last  time.Time
+	bytes int64
+	rate  float64
+}
+
+// add counts read bytes and returns true, when the rate is updated
+func (rr *readRate) add(n int) bool {
+	rr.mu.Lock()
+	defer rr.mu.Unlock()
+
+	now := time.Now()
+	// Paused playback should not lower the rate
+	if rr.start.IsZero() || now.Sub(rr.last) > readRateIdle {
+		rr.start = now
+		rr.bytes = 0
+	}
+	rr.last = now
+	rr.bytes += int64(n)
+
+	elapsed := now.Sub(rr.start)
+	if elapsed < readRateWindow {
+		return false
+	}
+
+	current := float64(rr.bytes) / elapsed.Seconds()
+	if rr.rate == 0 {
+		rr.rate = current
+	} else {
+		rr.rate = rr.rate*(1-readRateWeight) + current*readRateWeight
+	}
+
+	rr.start = now
+	rr.bytes = 0
+	return true
+}
+
+// reset drops current sample, since reads after seek are not a playback
+func (rr *readRate) reset() {
+	rr.mu.Lock()
+	defer rr.mu.Unlock()
+
+	rr.start = time.Time{}
+	rr.bytes = 0
+}
+
+// get returns bytes per second
+func (rr *readRate) get() int64 {
+	rr.mu.Lock()
+	defer rr.mu.Unlock()
+
+	return int64(rr.rate)
+}
+
+// playingDuration returns file, that is played by attached player, and its duration in seconds
+func (t *Torrent) playingDuration() (*File, float64) {
+	t.Service.mu.Lock()
+	defer t.Service.mu.Unlock()
+
+	for _, p := range t.Service.Players {
+		if p == nil || p.t != t || p.p == nil || p.chosenFile == nil {
+			continue
+		}
+
+		return p.chosenFile, p.p.VideoDuration
+	}
+
+	return nil, 0
+}
+
+// bitrate returns bytes per second of the file at current position,
+// container index is preferred, otherwise average bitrate from the player duration is used.
+func (tf *TorrentFSEntry) bitrate(playing *File, duration float64) (int64, string) {
+	if ci := tf.t.ContainerIndex(tf.f); ci != nil {
+		if pos, err := tf.Pos(); err == nil {
+			if rate := ci.BitrateAt(pos, readaheadDuration()); rate > 0 {
+				return rate, "index"
+			}
+		}
+	}
+
+	if playing != nil && playing.Index == tf.f.Index && duration > 0 {
+		return int64(float64(tf.f.Size) / duration), "duration"
+	}
+
+	return 0, ""
+}
+
+// adaptiveReadahead returns readahead, that holds configured seconds of playback,
+// with the rate of whichever is faster: playback bitrate or reader consumption.
+func (tf *TorrentFSEntry) adaptiveReadahead(playing *File, duration float64) int64 {
+	bitrate, _ := tf.bitrate(playing, duration)
+	if bitrate <= 0 {
+		return 0
+	}
+
+	rate := tf.rate.get()
+	if rate > bitrate*maxRateToBitrate {
+		rate = bitrate * maxRateToBitrate
+	}
+	if rate < bitrate {
+		rate = bitrate
+	}
+
+	return rate * int64(config.Get().ReadaheadSeconds)
+}
+
+// checkReadahead resets readers, when wanted readahead drifted away from current one
+func (tf *TorrentFSEntry) checkReadahead() {
+	if tf.isHead || !tf.IsActive() {
+		return
+	}
+
+	want := tf.adaptiveReadahead(tf.t.playingDuration())
+	if want <= 0 {
+		return
+	}
+
+	current := tf.readahead
+	diff := want - current
+	if diff < 0 {
+		diff = -diff
+	}
+	if current > 0 && float64(diff) < float64(current)*readaheadThreshold {
+		return
+	}
+
+	tf.t.ResetReaders()
+}
+
+func readaheadDuration() time.Duration {
+	return time.Duration(config.Get().ReadaheadSeconds) * time.Second
+}
@@ -0,0 +1,297 @@
+package bittorrent
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/goccy/go-json"
+
+	"github.com/elgatito/elementum/config"
+)
+
+const bandwidthScheduleFile = "bandwidth_schedule.json"
+
+var weekdays = map[string][]time.Weekday{
+	"sun":      {time.Sunday},
+	"mon":      {time.Monday},
+	"tue":      {time.Tuesday},
+	"wed":      {time.Wednesday},
+	"thu":      {time.Thursday},
+	"fri":      {time.Friday},
+	"sat":      {time.Saturday},
+	"weekdays": {time.Monday, time.Tuesday, time.Wednesday, time.Thursday, time.Friday},
+	"weekend":  {time.Saturday, time.Sunday},
+}
+
+// RateProfile is a named pair of download/upload limits, in KB/s. 0 means unlimited.
+type RateProfile struct {
+	Download int `json:"download"`
+	Upload   int `json:"upload"`
+}
+
+// ScheduleRule activates a profile on selected days within a time range.
+// Empty days means every day, empty from/to means the whole day.
+// If "to" is before "from" - the range passes midnight.
+type ScheduleRule struct {
+	Days    []string `json:"days"`
+	From    string   `json:"from"`
+	To      string   `json:"to"`
+	Profile string   `json:"profile"`
+
+	days []time.Weekday
+	from int
+	to   int
+}
+
+// BandwidthSchedule is a set of rate profiles and rules to switch between them.
+// First matching rule wins, if nothing matches - global limits from settings are used.
+type BandwidthSchedule struct {
+	Profiles map[string]RateProfile `json:"profiles"`
+	Rules    []*ScheduleRule        `json:"rules"`
+}
+
+// LoadBandwidthSchedule reads schedule from the profile folder
+func LoadBandwidthSchedule() (*BandwidthSchedule, error) {
+	filePath := filepath.Join(config.Get().ProfilePath, bandwidthScheduleFile)
+	b, err := os.ReadFile(filePath)
+	if err != nil {
+		return nil, err
+	}
+
+	schedule := &BandwidthSchedule{}
+	if err := json.Unmarshal(b, schedule); err != nil {
+		return nil, fmt.Errorf("Could not parse %s: %s", filePath, err)
+	}
+
+	for _, r := range schedule.Rules {
+		if err := r.parse(); err != nil {
+			return nil, err
+		}
+		if _, ok := schedule.Profiles[r.Profile]; !ok {
+			return nil, fmt.Errorf("Unknown bandwidth profile in schedule: %s", r.Profile)
+		}
+	}
+
+	return schedule, nil
+}
+
+// ActiveProfile returns name of the profile, active at the given time
+func (bs *BandwidthSchedule) ActiveProfile(now time.Time) string {
+	if bs == nil {
+		return ""
+	}
+
+	for _, r := range bs.Rules {
+		if r.matches(now) {
+			return r.Profile
+		}
+	}
+
+	return ""
+}
+
+func (r *ScheduleRule) parse() (err error) {
+	r.days = []time.Weekday{}
+	for _, d := range r.Days {
+		days, ok := weekdays[strings.ToLower(strings.TrimSpace(d))]
+		if !ok {
+			return fmt.Errorf("Unknown day in bandwidth schedule: %s", d)
+		}
+		r.days = append(r.days, days...)
+	}
+
+	if r.from, err = parseDayMinute(r.From, 0); err != nil {
+		return
+	}
+	r.to, err = parseDayMinute(r.To, 24*60)
+	return
+}
+
+func (r *ScheduleRule) matches(now time.Time) bool {
+	minute := now.Hour()*60 + now.Minute()
+	if r.from <= r.to {
+		return r.hasDay(now.Weekday()) && minute >= r.from && minute < r.to
+	}
+
+	// Range passes midnight, so the part after midnight belongs to the previous day
+	if minute >= r.from {
+		return r.hasDay(now.Weekday())
+	} else if minute < r.to {
+		return r.hasDay(now.AddDate(0, 0, -1).Weekday())
+	}
+	return false
+}
+
+func (r *ScheduleRule) hasDay(day time.Weekday) bool {
+	if len(r.days) == 0 {
+		return true
+	}
+
+	for _, d := range r.days {
+		if d == day {
+			return true
+		}
+	}
+	return false
+}
+
+func parseDayMinute(s string, def int) (int, error) {
+	if s == "" {
+		return def, nil
+	}
+
+	t, err := time.Parse("15:04", s)
+	if err != nil {
+		return 0, fmt.Errorf("Wrong time in bandwidth schedule: %s", s)
+	}
+	return t.Hour()*60 + t.Minute(), nil
+}
+
+// loadBandwidthSchedule reloads schedule file and selects active profile
+func (s *Service) loadBandwidthSchedule() {
+	s.muSchedule.Lock()
+	defer s.muSchedule.Unlock()
+
+	s.schedule = nil
+	s.activeRateProfile = ""
+	if !s.config.BandwidthScheduleEnabled {
+		return
+	}
+
+	schedule, err := LoadBandwidthSchedule()
+	if err != nil {
+		log.Warningf("Could not load bandwidth schedule: %s", err)
+		return
+	}
+
+	s.schedule = schedule
+	s.activeRateProfile = schedule.ActiveProfile(time.Now())
+	log.Infof("Loaded bandwidth schedule with %d profiles and %d rules, active profile: %q", len(schedule.Profiles), len(schedule.Rules), s.activeRateProfile)
+}
+
+// GetActiveRateProfile returns name of currently active scheduled profile,
+// empty string means limits from settings are used.
+func (s *Service) GetActiveRateProfile() string {
+	s.muSchedule.Lock()
+	defer s.muSchedule.Unlock()
+
+	return s.activeRateProfile
+}
+
+// GetBandwidthSchedule returns loaded bandwidth schedule
+func (s *Service) GetBandwidthSchedule() *BandwidthSchedule {
+	s.muSchedule.Lock()
+	defer s.muSchedule.Unlock()
+
+	return s.schedule
+}
+
+// GetRateLimits returns session-wide download/upload limits in bytes/s,
+// taken from active scheduled profile, or from settings,
+// and lowered by data-cap throttling.
+func (s *Service) GetRateLimits() (downloadLimit, uploadLimit int) {
+	downloadLimit, uploadLimit = s.scheduledRateLimits()
+
+	quotaDownload, quotaUpload := s.quotaRateLimits()
+	if quotaDownload > 0 && (downloadLimit <= 0 || downloadLimit > quotaDownload) {
+		downloadLimit = quotaDownload
+	}
+	if quotaUpload > 0 && (uploadLimit <= 0 || uploadLimit > quotaUpload) {
+		uploadLimit = quotaUpload
+	}
+
+	return
+}
+
+func (s *Service) scheduledRateLimits() (downloadLimit, uploadLimit int) {
+	s.muSchedule.Lock()
+	defer s.muSchedule.Unlock()
+
+	if s.schedule != nil && s.activeRateProfile != "" {
+		if p, ok := s.schedule.Profiles[s.activeRateProfile]; ok {
+			return p.Download * 1024, p.Upload * 1024
+		}
+	}
+
+	return s.config.DownloadRateLimit, s.config.UploadRateLimit
+}
+
+// watchBandwidthSchedule switches rate profiles according to the schedule
+func (s *Service) watchBandwidthSchedule() {
+	closing := s.Closer.C()
+	ticker := time.NewTicker(30 * time.Second)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-closing:
+			return
+
+		case <-ticker.C:
+			s.switchRateProfile()
+		}
+	}
+}
+
+func (s *Service) switchRateProfile() {
+	s.muSchedule.Lock()
+	if s.schedule == nil {
+		s.muSchedule.Unlock()
+		return
+	}
+
+	profile := s.schedule.ActiveProfile(time.Now())
+	if profile == s.activeRateProfile {
+		s.muSchedule.Unlock()
+		return
+	}
+
+	log.Infof("Switching bandwidth profile from %q to %q", s.activeRateProfile, profile)
+	s.activeRateProfile = profile
+	s.muSchedule.Unlock()
+
+	// With "limit after buffering" the session is limited only after a player finished buffering,
+	// otherwise new profile limits are applied by the player, when buffering finishes.
+	if s.config.LimitAfterBuffering && !s.hasBufferedPlayer() {
+		return
+	}
+
+	s.RestoreLimits()
+}
+
+// IsBuffering checks whether any torrent is currently buffering
+func (s *Service) IsBuffering() bool {
+	for _, t := range s.q.All() {
+		if t == nil {
+			continue
+		}
+		if isBuffering, _ := t.GetBufferingState(); isBuffering {
+			return true
+		}
+	}
+
+	return false
+}
+
+// hasBufferedPlayer checks whether any attached player has finished buffering
+func (s *Service) hasBufferedPlayer() bool {
+	s.mu.Lock()
+	torrents := make([]*Torrent, 0, len(s.Players))
+	for _, p := range s.Players {
+		if p != nil && p.t != nil {
+			torrents = append(torrents, p.t)
+		}
+	}
+	s.mu.Unlock()
+
+	for _, t := range torrents {
+		if _, isFinished := t.GetBufferingState(); isFinished {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,109 @@
+package bittorrent
+
+import (
+	"testing"
+	"time"
+)
+
+func TestScheduleRuleMatches(t *testing.T) {
+	// 2024-01-01 is Monday
+	at := func(day int, clock string) time.Time {
+		c, _ := time.Parse("15:04", clock)
+		return time.Date(2024, 1, day, c.Hour(), c.Minute(), 0, 0, time.Local)
+	}
+	monday, friday, saturday, sunday := 1, 5, 6, 7
+
+	tests := []struct {
+		name string
+		rule ScheduleRule
+		now  time.Time
+		want bool
+	}{
+		{name: "whole day", rule: ScheduleRule{}, now: at(monday, "00:00"), want: true},
+		{name: "whole day end", rule: ScheduleRule{}, now: at(monday, "23:59"), want: true},
+		{name: "inside range", rule: ScheduleRule{From: "09:00", To: "18:00"}, now: at(monday, "12:30"), want: true},
+		{name: "range start", rule: ScheduleRule{From: "09:00", To: "18:00"}, now: at(monday, "09:00"), want: true},
+		{name: "range end is excluded", rule: ScheduleRule{From: "09:00", To: "18:00"}, now: at(monday, "18:00"), want: false},
+		{name: "before range", rule: ScheduleRule{From: "09:00", To: "18:00"}, now: at(monday, "08:59"), want: false},
+		{name: "only from", rule: ScheduleRule{From: "20:00"}, now: at(monday, "23:59"), want: true},
+		{name: "only to", rule: ScheduleRule{To: "06:00"}, now: at(monday, "06:01"), want: false},
+		{name: "weekdays", rule: ScheduleRule{Days: []string{"weekdays"}}, now: at(friday, "12:00"), want: true},
+		{name: "not weekdays", rule: ScheduleRule{Days: []string{"weekdays"}}, now: at(saturday, "12:00"), want: false},
+		{name: "weekend", rule: ScheduleRule{Days: []string{"Weekend"}}, now: at(sunday, "12:00"), want: true},
+		{name: "several days", rule: ScheduleRule{Days: []string{"mon", " fri "}}, now: at(friday, "12:00"), want: true},
+		{name: "midnight before", rule: ScheduleRule{From: "22:00", To: "06:00"}, now: at(monday, "23:00"), want: true},
+		{name: "midnight after", rule: ScheduleRule{From: "22:00", To: "06:00"}, now: at(monday, "05:59"), want: true},
+		{name: "midnight outside", rule: ScheduleRule{From: "22:00", To: "06:00"}, now: at(monday, "12:00"), want: false},
+		{name: "midnight belongs to previous day", rule: ScheduleRule{Days: []string{"fri"}, From: "22:00", To: "06:00"}, now: at(saturday, "02:00"), want: true},
+		{name: "midnight not of previous day", rule: ScheduleRule{Days: []string{"fri"}, From: "22:00", To: "06:00"}, now: at(friday, "02:00"), want: false},
+		{name: "midnight on the day", rule: ScheduleRule{Days: []string{"fri"}, From: "22:00", To: "06:00"}, now: at(friday, "22:30"), want: true},
+		{name: "midnight week wrap", rule: ScheduleRule{Days: []string{"sun"}, From: "23:00", To: "01:00"}, now: at(monday+7, "00:30"), want: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := tt.rule.parse(); err != nil {
+				t.Fatalf("parse() error = %v", err)
+			}
+			if got := tt.rule.matches(tt.now); got != tt.want {
+				t.Errorf("matches(%s) = %v, want %v", tt.now.Format("Mon 15:04"), got, tt.want)
+			}
+		})
+	}
+}
+
+func TestScheduleRuleParse(t *testing.T) {
+	tests := []struct {
+		name string
+		rule ScheduleRule
+		ok   bool
+	}{
+		{name: "valid", rule: ScheduleRule{Days: []string{"mon"}, From: "08:00", To: "17:30"}, ok: true},
+		{name: "unknown day", rule: ScheduleRule{Days: []string{"monday"}}, ok: false},
+		{name: "wrong time", rule: ScheduleRule{From: "25:00"}, ok: false},
+		{name: "wrong format", rule: ScheduleRule{To: "8pm"}, ok: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := tt.rule.parse(); (err == nil) != tt.ok {
+				t.Errorf("parse() error = %v, want ok %v", err, tt.ok)
+			}
+		})
+	}
+}
+
+func TestBandwidthScheduleActiveProfile(t *testing.T) {
+	bs := &BandwidthSchedule{
+		Profiles: map[string]RateProfile{"night": {}, "work": {Download: 100}},
+		Rules: []*ScheduleRule{
+			{Days: []string{"weekdays"}, From: "09:00", To: "18:00", Profile: "work"},
+			{From: "22:00", To: "07:00", Profile: "night"},
+		},
+	}
+	for _, r := range bs.Rules {
+		if err := r.parse(); err != nil {
+			t.Fatalf("parse() error = %v", err)
+		}
+	}
+
+	tests := []struct {
+		now  time.Time
+		want string
+	}{
+		{now: time.Date(2024, 1, 1, 10, 0, 0, 0, time.Local), want: "work"},
+		{now: time.Date(2024, 1, 6, 10, 0, 0, 0, time.Local), want: ""},
+		{now: time.Date(2024, 1, 6, 23, 0, 0, 0, time.Local), want: "night"},
+	}
+
+	for _, tt := range tests {
+		if got := bs.ActiveProfile(tt.now); got != tt.want {
+			t.Errorf("ActiveProfile(%s) = %q, want %q", tt.now.Format("Mon 15:04"), got, tt.want)
+		}
+	}
+
+	var empty *BandwidthSchedule
+	if got := empty.ActiveProfile(time.Now()); got != "" {
+		t.Errorf("nil schedule ActiveProfile() = %q, want empty", got)
+	}
+}
@@ -68,6 +68,36 @@ type Service struct {
 
 	dialogProgressBG *xbmc.DialogProgressBG
 
+	muSchedule        sync.Mutex
+	schedule          *BandwidthSchedule
+	activeRateProfile string
+
+	muQuota            sync.Mutex
+	quota              *QuotaStatus
+	quotaState         *database.QuotaState
+	quotaDownloadLimit int
+	quotaUploadLimit   int
+
+	muDiskSpace     sync.Mutex
+	diskSpaceLevel  int
+	diskSpacePaused []string
+
+	muCleanup sync.Mutex
+
+	muPreview     sync.Mutex
+	previewTimers map[string]*time.Timer
+
+	muHooks  sync.Mutex
+	hooks    []*Hook
+	hookLogs map[string][]*HookLogEntry
+
+	muCategories sync.Mutex
+	categories   map[string]*Category
+
+	muWatchFolder    sync.Mutex
+	watchFolder      *watcher.Watcher
+	watchFolderFiles map[string]bool
+
 	alertsBroadcaster *broadcast.Broadcaster
 	Closer            event.Event
 	CloserNotifier    event.Event
@@ -122,6 +152,12 @@ func NewService() *Service {
 		s.loadTorrentFiles()
 	}()
 	go s.onDownloadProgress()
+	go s.watchBandwidthSchedule()
+
+	s.wg.Add(1)
+	go s.watchStats()
+	go s.watchDiskSpace()
+	go s.watchCleanup()
 
 	return s
 }
@@ -297,15 +333,19 @@ func (s *Service) configure() {
 		settings.SetInt("connection_speed", s.config.ConnTrackerLimit)
 	}
 
+	s.loadBandwidthSchedule()
+	s.loadCategories()
+	s.loadHooks()
 	if !s.config.LimitAfterBuffering {
-		if s.config.DownloadRateLimit > 0 {
-			log.Infof("Rate limiting download to %s", humanize.Bytes(uint64(s.config.DownloadRateLimit)))
-			settings.SetInt("download_rate_limit", s.config.DownloadRateLimit)
+		downloadLimit, uploadLimit := s.GetRateLimits()
+		if downloadLimit > 0 {
+			log.Infof("Rate limiting download to %s", humanize.Bytes(uint64(downloadLimit)))
+			settings.SetInt("download_rate_limit", downloadLimit)
 		}
-		if s.config.UploadRateLimit > 0 {
-			log.Infof("Rate limiting upload to %s", humanize.Bytes(uint64(s.config.UploadRateLimit)))
+		if uploadLimit > 0 {
+			log.Infof("Rate limiting upload to %s", humanize.Bytes(uint64(uploadLimit)))
 			// If we have an upload rate, use the nicer bittyrant choker
-			settings.SetInt("upload_rate_limit", s.config.UploadRateLimit)
+			settings.SetInt("upload_rate_limit", uploadLimit)
 			settings.SetInt("choking_algorithm", int(lt.SettingsPackBittyrantChoker))
 		}
 	}
@@ -448,6 +488,13 @@ func (s *Service) configure() {
 		settings.SetInt("min_reconnect_time", 20)
 	}
 
+	// Queue is managed by Elementum, so libtorrent should not stop auto-managed torrents
+	if s.config.MaxActiveDownloads > 0 || s.config.MaxActiveSeeds > 0 {
+		settings.SetInt("active_downloads", -1)
+		settings.SetInt("active_seeds", -1)
+		settings.SetInt("active_limit", -1)
+	}
+
 	var listenPorts []string
 	if s.config.ListenAutoDetectPort {
 		s.config.ListenPortMin = 6891
@@ -541,9 +588,13 @@ func (s *Service) startServices() {
 		s.mappedPorts[p] = s.Session.AddPortMapping(lt.WrappedSessionHandleTcp, port, port)
 		log.Infof("Adding port mapping %v: %v", port, s.mappedPorts[p])
 	}
+
+	s.startWatchFolder()
 }
 
 func (s *Service) stopServices() {
+	s.stopWatchFolder()
+
 	if s.InternalProxy != nil && !s.InternalProxy.IsErrored && s.InternalProxy.Server != nil {
 		log.Infof("Stopping internal proxy")
 		s.InternalProxy.Server.Shutdown(context.Background())
@@ -609,9 +660,10 @@ func (s *Service) checkAvailableSpace(xbmcHost *xbmc.XBMCHost, t *Torrent) bool
 		return true
 	}
 
-	diskStatus, err := diskusage.DiskUsage(config.Get().DownloadPath)
+	path := t.GetSavePath()
+	diskStatus, err := diskusage.DiskUsage(path)
 	if err != nil {
-		log.Warningf("Unable to retrieve the free space for %s, continuing anyway...", config.Get().DownloadPath)
+		log.Warningf("Unable to retrieve the free space for %s, continuing anyway...", path)
 		return false
 	}
 
@@ -631,7 +683,6 @@ func (s *Service) checkAvailableSpace(xbmcHost *xbmc.XBMCHost, t *Torrent) bool
 	totalDone := status.GetTotalDone()
 	sizeLeft := totalSize - totalDone
 	availableSpace := diskStatus.Free
-	path := status.GetSavePath()
 
 	log.Infof("Checking for sufficient space on %s...", path)
 	log.Infof("Total size of download: %s", humanize.Bytes(uint64(totalSize)))
@@ -663,7 +714,7 @@ func (s *Service) AddTorrent(xbmcHost *xbmc.XBMCHost, options AddOptions) (*Torr
 
 	log.Infof("Adding torrent from %s", options.URI)
 
-	if options.DownloadStorage != config.StorageMemory && s.config.DownloadPath == "." {
+	if options.DownloadStorage != config.StorageMemory && !options.Preview && s.GetCategorySavePath(options.Category) == "." {
 		log.Warningf("Cannot add torrent since download path is not set")
 		if xbmcHost != nil {
 			xbmcHost.Notify("Elementum", "LOCALIZE[30113]", config.AddonIcon())
@@ -752,8 +803,17 @@ func (s *Service) AddTorrent(xbmcHost *xbmc.XBMCHost, options AddOptions) (*Torr
 		infoHash = hex.EncodeToString([]byte(shaHash))
 	}
 
-	log.Infof("Setting save path to %s", s.config.DownloadPath)
-	torrentParams.SetSavePath(s.config.DownloadPath)
+	// Preview torrent is replaced by a real one
+	if t := s.q.FindByHash(infoHash); t != nil && t.IsPreview && !options.Preview {
+		s.dropPreview(t)
+	}
+	if options.Preview {
+		torrentParams.SetFlags(torrentParams.GetFlags() | uint64(lt.AddTorrentParamsFlagUploadMode))
+	}
+
+	savePath := s.GetCategorySavePath(options.Category)
+	log.Infof("Setting save path to %s", savePath)
+	torrentParams.SetSavePath(savePath)
 
 	skipPriorities := false
 	if options.DownloadStorage != config.StorageMemory {
@@ -838,6 +898,12 @@ func (s *Service) AddTorrent(xbmcHost *xbmc.XBMCHost, options AddOptions) (*Torr
 		log.Debugf("After modifications loaded torrent has %d trackers", th.Trackers().Size())
 	}
 
+	// Trackers, edited for this torrent, take precedence over global modifications
+	if item := database.GetStorm().GetBTItem(infoHash); item != nil && item.Trackers != nil && !options.Preview {
+		log.Debugf("Restoring %d edited trackers", len(item.Trackers))
+		replaceTrackers(th, item.Trackers, item.TrackerTiers)
+	}
+
 	log.Infof("Setting sequential download to: %v", options.DownloadStorage != config.StorageMemory)
 	th.SetSequentialDownload(options.DownloadStorage != config.StorageMemory)
 
@@ -849,6 +915,9 @@ func (s *Service) AddTorrent(xbmcHost *xbmc.XBMCHost, options AddOptions) (*Torr
 	}
 
 	t.addedTime = options.AddedTime
+	t.savePath = savePath
+	t.category = options.Category
+	t.IsPreview = options.Preview
 	s.q.Add(t)
 
 	if !t.HasMetadata() {
@@ -863,6 +932,12 @@ func (s *Service) AddTorrent(xbmcHost *xbmc.XBMCHost, options AddOptions) (*Torr
 	t.onMetadataReceived()
 	t.init()
 
+	if options.Category != "" && options.FirstTime && !options.Preview {
+		if err := database.GetStorm().UpdateBTItemCategory(infoHash, options.Category); err != nil {
+			log.Warningf("Could not save category for torrent %s: %s", infoHash, err)
+		}
+	}
+
 	go t.Watch()
 
 	return t, nil
@@ -924,9 +999,20 @@ func (s *Service) RemoveTorrent(xbmcHost *xbmc.XBMCHost, t *Torrent, flags Remov
 			database.GetStorm().DeleteBTItem(t.InfoHash())
 		}()
 
+		// Completed move fires own event after files are moved
+		if !t.IsMoveInProgress && !t.IsPreview {
+			s.fireHooks(t.newHookPayload(HookTorrentRemoved))
+		}
+
+		// Keep transfers since last sample in the history
+		s.recordStats(t)
+
 		s.q.Delete(t)
 
 		t.Drop(deleteTorrentFiles, deleteTorrentData)
+
+		// Removed torrent could free a slot for queued torrents
+		go s.UpdateQueue()
 	}
 
 	return true
@@ -953,14 +1039,20 @@ func (s *Service) onStateChanged(stateAlert lt.StateChangedAlert) {
 	}
 }
 
-// GetTorrentByHash ...
+// GetTorrentByHash returns torrent by infohash, preview torrents are not included
 func (s *Service) GetTorrentByHash(hash string) *Torrent {
-	return s.q.FindByHash(hash)
+	if t := s.q.FindByHash(hash); t != nil && !t.IsPreview {
+		return t
+	}
+	return nil
 }
 
-// GetTorrentByURI ...
+// GetTorrentByURI returns torrent by uri, preview torrents are not included
 func (s *Service) GetTorrentByURI(uri string) *Torrent {
-	return s.q.FindByURI(uri)
+	if t := s.q.FindByURI(uri); t != nil && !t.IsPreview {
+		return t
+	}
+	return nil
 }
 
 func (s *Service) onSaveResumeDataWriter() {
@@ -976,8 +1068,14 @@ func (s *Service) onSaveResumeDataWriter() {
 			log.Info("Closing resume data loop...")
 			return
 		case <-saveResumeWait.C:
+			// Half-written resume files are worse than outdated ones
+			if s.IsDiskSpaceCritical() {
+				continue
+			}
+
 			for _, t := range s.q.All() {
-				if t == nil || t.th == nil || t.th.Swigcptr() == 0 || !t.th.IsValid() {
+				// Preview is in upload mode without selected files, it should not be restored that way
+				if t == nil || t.IsPreview || t.th == nil || t.th.Swigcptr() == 0 || !t.th.IsValid() {
 					continue
 				}
 
@@ -1020,6 +1118,10 @@ func (s *Service) onSaveResumeDataConsumer() {
 				var torrentFile *TorrentFileRaw
 				if err := dec.Decode(&torrentFile); err != nil {
 					log.Warningf("Resume data corrupted for %s, %d bytes received and failed to decode with: %s, skipping...", alert.Name, len(bEncoded), err.Error())
+				} else if s.IsDiskSpaceCritical() {
+					log.Warningf("Skipping resume data for %s due to low disk space", alert.Name)
+				} else if t := s.q.FindByHash(alert.InfoHash); t != nil && t.IsPreview {
+					log.Debugf("Skipping resume data for preview torrent %s", alert.Name)
 				} else {
 					path := filepath.Join(s.config.TorrentsPath, fmt.Sprintf("%s.fastresume", alert.InfoHash))
 					os.WriteFile(path, bEncoded, 0644)
@@ -1080,6 +1182,10 @@ func (s *Service) onAlertsConsumer() {
 					shaHash := torrentStatus.GetInfoHash().ToString()
 					infoHash = hex.EncodeToString([]byte(shaHash))
 					entry = saveResumeData.ResumeData()
+				case lt.TorrentRemovedAlertAlertType:
+					// Handle is not valid anymore, only info hash is kept in the alert
+					removedAlert := lt.SwigcptrTorrentRemovedAlert(alertPtr)
+					infoHash = hex.EncodeToString([]byte(removedAlert.GetInfoHash().ToString()))
 				case lt.ExternalIpAlertAlertType:
 					splitMessage := strings.Split(alertMessage, ":")
 					splitIP := strings.Split(splitMessage[len(splitMessage)-1], ".")
@@ -1105,13 +1211,25 @@ func (s *Service) onAlertsConsumer() {
 							t.trackers.Store("DHT", ta.GetNumPeers())
 						}
 					}
+				case lt.FileRenamedAlertAlertType:
+					ta := lt.SwigcptrFileRenamedAlert(alertPtr)
+					for _, t := range s.q.All() {
+						if t.th != nil && ta.GetHandle().Equal(t.th) {
+							t.MakeFiles()
+						}
+					}
 				case lt.TorrentFinishedAlertAlertType:
 					ta := lt.SwigcptrTorrentFinishedAlert(alertPtr)
 					for _, t := range s.q.All() {
 						if t.th != nil && ta.GetHandle().Equal(t.th) {
 							go t.AlertFinished()
+							if !t.IsPreview {
+								s.recordDownloaded(t)
+								s.fireFinishedHooks(t)
+							}
 						}
 					}
+					go s.UpdateQueue()
 				}
 
 				alert := &Alert{
@@ -1225,7 +1343,12 @@ func (s *Service) loadTorrentFiles() {
 		filePath := filepath.Join(s.config.TorrentsPath, torrentFile.Name())
 		log.Infof("Loading torrent file %s", torrentFile.Name())
 
-		t, err := s.AddTorrent(xbmcHost, AddOptions{URI: filePath, Paused: s.config.AutoloadTorrentsPaused, DownloadStorage: config.StorageFile, FirstTime: false, AddedTime: torrentFile.ModTime()})
+		category := ""
+		if i := database.GetStorm().GetBTItem(util.FileWithoutExtension(torrentFile.Name())); i != nil {
+			category = i.Category
+		}
+
+		t, err := s.AddTorrent(xbmcHost, AddOptions{URI: filePath, Paused: s.config.AutoloadTorrentsPaused, DownloadStorage: config.StorageFile, FirstTime: false, AddedTime: torrentFile.ModTime(), Category: category})
 		if err != nil {
 			log.Warningf("Cannot add torrent from existing file %s: %s", filePath, err)
 			continue
@@ -1239,6 +1362,7 @@ func (s *Service) loadTorrentFiles() {
 		}
 
 		t.DBItem = i
+		t.RestoreLimits()
 
 		files := []*File{}
 		for _, p := range i.Files {
@@ -1252,7 +1376,12 @@ func (s *Service) loadTorrentFiles() {
 		t.SyncSelectedFiles()
 	}
 
-	s.cleanStaleFiles(s.config.DownloadPath, ".parts")
+	s.q.Sort()
+	s.UpdateQueue()
+
+	for _, path := range s.getSavePaths() {
+		s.cleanStaleFiles(path, ".parts")
+	}
 	s.cleanStaleFiles(s.config.TorrentsPath, ".fastresume")
 }
 
@@ -1309,6 +1438,8 @@ func (s *Service) onDownloadProgress() {
 				return
 			}
 
+			s.UpdateQueue()
+
 			var totalDownloadRate float64
 			var totalUploadRate float64
 			var totalProgress int
@@ -1370,47 +1501,28 @@ func (s *Service) onDownloadProgress() {
 					seedingTime = finishedTime
 				}
 
-				if !t.IsMemoryStorage() && s.config.SeedTimeLimit > 0 && !s.config.SeedForever {
-					if seedingTime >= s.config.SeedTimeLimit {
-						if !isPaused {
-							log.Warningf("Seeding time limit reached, pausing %s", torrentName)
-							torrentHandle.AutoManaged(false)
-							torrentHandle.Pause(1)
-							isPaused = true
-						}
-						status = StatusStrings[StatusSeeding]
-					}
-				}
-				if !t.IsMemoryStorage() && s.config.SeedTimeRatioLimit > 0 && !s.config.SeedForever {
-					timeRatio := 0
-					downloadTime := ts.GetActiveTime() - seedingTime
-					if downloadTime > 1 {
-						timeRatio = seedingTime * 100 / downloadTime
-					}
-					if timeRatio >= s.config.SeedTimeRatioLimit {
-						if !isPaused {
-							log.Warningf("Seeding time ratio reached, pausing %s", torrentName)
-							torrentHandle.AutoManaged(false)
-							torrentHandle.Pause(1)
-							isPaused = true
+				if reason := t.seedLimitReached(ts, seedingTime); reason != "" {
+					policy := t.GetSeedPolicy()
+					if policy.EndAction != SeedActionPause && t.PlayerAttached <= 0 && !t.IsMoveInProgress {
+						// Removal can take longer than a tick, so it is started only once
+						if !t.IsRemoveInProgress {
+							log.Warningf("%s, removing %s", reason, torrentName)
+							t.IsRemoveInProgress = true
+							go func(t *Torrent, opts RemoveOptions) {
+								if !s.RemoveTorrent(nil, t, opts) {
+									t.IsRemoveInProgress = false
+								}
+							}(t, RemoveOptions{ForceDrop: true, ForceKeepTorrentData: policy.EndAction == SeedActionRemove, ForceDelete: policy.EndAction == SeedActionRemoveData})
 						}
-						status = StatusStrings[StatusSeeding]
+						continue
 					}
-				}
-				if !t.IsMemoryStorage() && s.config.ShareRatioLimit > 0 && !s.config.SeedForever {
-					ratio := int64(0)
-					allTimeDownload := ts.GetAllTimeDownload()
-					if allTimeDownload > 0 {
-						ratio = ts.GetAllTimeUpload() * 100 / allTimeDownload
-					}
-					if ratio >= int64(s.config.ShareRatioLimit) {
-						if !isPaused {
-							log.Warningf("Share ratio reached, pausing %s", torrentName)
-							torrentHandle.AutoManaged(false)
-							torrentHandle.Pause(1)
-						}
-						status = StatusStrings[StatusSeeding]
+
+					if !isPaused {
+						log.Warningf("%s, pausing %s", reason, torrentName)
+						torrentHandle.AutoManaged(false)
+						torrentHandle.Pause(1)
 					}
+					status = StatusStrings[StatusSeeding]
 				}
 
 				if t.IsMarkedToMove {
@@ -1418,6 +1530,22 @@ func (s *Service) onDownloadProgress() {
 					status = StatusStrings[StatusSeeding]
 				}
 
+				//
+				// Handle renaming completed downloads inside of the torrent
+				//
+				if s.config.CompletedRenameInTorrent && !s.config.CompletedMove && !t.IsRenamed && !t.IsMemoryStorage() && status == StatusStrings[StatusSeeding] && t.PlayerAttached <= 0 {
+					t.IsRenamed = true
+					go func(t *Torrent) {
+						files, err := t.OrganizeFiles(database.GetStorm().GetBTItem(t.InfoHash()))
+						if err == nil {
+							err = t.RenameFiles(files)
+						}
+						if err != nil {
+							log.Warningf("Could not rename files of %s: %s", t.Name(), err)
+						}
+					}(t)
+				}
+
 				//
 				// Handle moving completed downloads
 				//
@@ -1448,15 +1576,30 @@ func (s *Service) onDownloadProgress() {
 						return fmt.Errorf("Torrent not found with infohash: %s", infoHash)
 					}
 
+					// Category completed path takes precedence over media type paths
+					categoryPath := ""
+					if c := s.GetCategory(item.Category); c != nil {
+						categoryPath = c.CompletedPath
+					}
+
 					errMsg := fmt.Sprintf("Missing item type to move files to completed folder for %s", torrentName)
-					if item.Type == "" {
+					if item.Type == "" && categoryPath == "" {
 						log.Error(errMsg)
 						return errors.New(errMsg)
 					}
 					log.Warning(torrentName, "finished seeding, moving files...")
 
 					// Check paths are valid and writable, and only once
-					if _, exists := pathChecked[item.Type]; !exists {
+					if categoryPath != "" {
+						if _, exists := pathChecked[categoryPath]; !exists {
+							pathChecked[categoryPath] = true
+							if err := util.IsWritablePath(categoryPath); err != nil {
+								warnedMissing[infoHash] = true
+								log.Error(err)
+								return err
+							}
+						}
+					} else if _, exists := pathChecked[item.Type]; !exists {
 						if item.Type == "movie" {
 							if err := util.IsWritablePath(s.config.CompletedMoviesPath); err != nil {
 								warnedMissing[infoHash] = true
@@ -1476,13 +1619,28 @@ func (s *Service) onDownloadProgress() {
 						}
 					}
 
+					hookPayload := t.newHookPayload(HookTorrentMoved)
+
+					// Renaming files according to templates, files that are not organized are moved as is
+					organized := map[string]string{}
+					if s.config.CompletedRename && item.Type != "" {
+						if files, err := t.OrganizeFiles(item); err != nil {
+							log.Warningf("Could not organize files of %s, moving as is: %s", torrentName, err)
+						} else {
+							for _, f := range files {
+								organized[f.Path] = f.Target
+							}
+						}
+					}
+
 					// Preparing list of files that need to be moved
 					torrentInfo := torrentHandle.TorrentFile()
 					filesToMove := []string{}
 					filesToCleanup := map[string]bool{}
 					for _, fp := range t.files {
 						f := t.GetFileByPath(fp.Path)
-						filesToMove = append(filesToMove, torrentInfo.Files().FilePath(f.Index))
+						filePath := torrentInfo.Files().FilePath(f.Index)
+						filesToMove = append(filesToMove, filePath)
 					}
 
 					log.Infof("Moving torrent '%s' to completed folder", t.Name())
@@ -1502,7 +1660,7 @@ func (s *Service) onDownloadProgress() {
 						extracted := ""
 						re := regexp.MustCompile(`(?i).*\.rar$`)
 						if re.MatchString(fileName) {
-							extractedPath := filepath.Join(s.config.DownloadPath, filepath.Dir(filePath), "extracted")
+							extractedPath := filepath.Join(t.GetSavePath(), filepath.Dir(filePath), "extracted")
 							files, err := os.ReadDir(extractedPath)
 							if err != nil {
 								return err
@@ -1527,7 +1685,19 @@ func (s *Service) onDownloadProgress() {
 						}
 
 						var dstPath string
-						if item.Type == "movie" {
+						if target, ok := organized[filePath]; ok {
+							if categoryPath != "" {
+								dstPath = util.EffectiveDir(categoryPath)
+							} else if item.Type == "movie" {
+								dstPath = util.EffectiveDir(s.config.CompletedMoviesPath)
+							} else {
+								dstPath = util.EffectiveDir(s.config.CompletedShowsPath)
+							}
+							dstPath = filepath.Join(dstPath, filepath.FromSlash(target))
+							os.MkdirAll(filepath.Dir(dstPath), 0755)
+						} else if categoryPath != "" {
+							dstPath = util.EffectiveDir(categoryPath)
+						} else if item.Type == "movie" {
 							dstPath = util.EffectiveDir(s.config.CompletedMoviesPath)
 						} else {
 							dstPath = util.EffectiveDir(s.config.CompletedShowsPath)
@@ -1545,18 +1715,19 @@ func (s *Service) onDownloadProgress() {
 							}
 						}
 
-						srcPath := filepath.Join(s.config.DownloadPath, filePath)
+						srcPath := filepath.Join(t.GetSavePath(), filePath)
 						log.Infof("Moving file %s to %s", srcPath, dstPath)
 						if dst, err := util.Move(srcPath, dstPath); err != nil {
 							log.Error(err)
 						} else {
 							log.Warning(fileName, "moved to", dst)
+							hookPayload.Files = append(hookPayload.Files, dst)
 
 							if dirPath := filepath.Dir(filePath); dirPath != "." {
 								filesToCleanup[filepath.Dir(srcPath)] = true
 								if extracted != "" {
 									parentPath := filepath.Clean(filepath.Join(filepath.Dir(srcPath), ".."))
-									if parentPath != "." && parentPath != s.config.DownloadPath {
+									if parentPath != "." && parentPath != t.GetSavePath() {
 										filesToCleanup[parentPath] = true
 									}
 								}
@@ -1570,9 +1741,16 @@ func (s *Service) onDownloadProgress() {
 						os.RemoveAll(filePath)
 					}
 
+					// Duplicates are detected by new file locations
+					if len(hookPayload.Files) > 0 {
+						database.GetStorm().UpdateDownloadedItemFiles(infoHash, hookPayload.Files)
+					}
+
 					log.Infof("Marking %s for removal from library and database...", torrentName)
 					database.GetStorm().UpdateBTItemStatus(infoHash, Remove)
 
+					s.fireHooks(hookPayload)
+
 					return nil
 				}(t)
 			}
@@ -1624,11 +1802,13 @@ func (s *Service) SetUploadLimit(i int) {
 	s.Session.ApplySettings(settings)
 }
 
-// RestoreLimits ...
+// RestoreLimits applies session-wide limits from settings or from active scheduled profile
 func (s *Service) RestoreLimits() {
-	if s.config.DownloadRateLimit > 0 {
-		s.SetDownloadLimit(s.config.DownloadRateLimit)
-		log.Infof("Rate limiting download to %s", humanize.Bytes(uint64(s.config.DownloadRateLimit)))
+	downloadLimit, uploadLimit := s.GetRateLimits()
+
+	if downloadLimit > 0 {
+		s.SetDownloadLimit(downloadLimit)
+		log.Infof("Rate limiting download to %s", humanize.Bytes(uint64(downloadLimit)))
 	} else {
 		s.SetDownloadLimit(0)
 	}
@@ -1637,9 +1817,9 @@ func (s *Service) RestoreLimits() {
 	// 	s.SetUploadLimit(1)
 	// 	log.Infof("Rate limiting upload to %d byte, due to disabled upload", 1)
 	// } else if s.config.UploadRateLimit > 0 {
-	if s.config.UploadRateLimit > 0 {
-		s.SetUploadLimit(s.config.UploadRateLimit)
-		log.Infof("Rate limiting upload to %s", humanize.Bytes(uint64(s.config.UploadRateLimit)))
+	if uploadLimit > 0 {
+		s.SetUploadLimit(uploadLimit)
+		log.Infof("Rate limiting upload to %s", humanize.Bytes(uint64(uploadLimit)))
 	} else {
 		s.SetUploadLimit(0)
 	}
@@ -1921,7 +2101,14 @@ func (s *Service) HasTorrentByFakeID(query string) *Torrent {
 
 // GetTorrents return all active torrents
 func (s *Service) GetTorrents() []*Torrent {
-	return s.q.All()
+	all := s.q.All()
+	ret := make([]*Torrent, 0, len(all))
+	for _, t := range all {
+		if !t.IsPreview {
+			ret = append(ret, t)
+		}
+	}
+	return ret
 }
 
 // GetListenIP returns calculated IP for TCP/TCP6
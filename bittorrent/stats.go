@@ -0,0 +1,206 @@
+package bittorrent
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/elgatito/elementum/database"
+)
+
+const (
+	statsInterval = 1 * time.Minute
+
+	statsDailyPeriods  = 30
+	statsWeeklyPeriods = 12
+)
+
+// StatsPeriod is transferred bytes for a day, week, month or all time
+type StatsPeriod struct {
+	Period     string  `json:"period"`
+	Downloaded int64   `json:"downloaded"`
+	Uploaded   int64   `json:"uploaded"`
+	Ratio      float64 `json:"ratio"`
+}
+
+// StatsTorrent is all-time transferred bytes of a torrent
+type StatsTorrent struct {
+	InfoHash   string    `json:"infoHash"`
+	Name       string    `json:"name"`
+	Downloaded int64     `json:"downloaded"`
+	Uploaded   int64     `json:"uploaded"`
+	Ratio      float64   `json:"ratio"`
+	Active     bool      `json:"active"`
+	Added      time.Time `json:"added"`
+	Updated    time.Time `json:"updated"`
+}
+
+// Stats is transfer history, aggregated by periods, recent periods first
+type Stats struct {
+	Today    *StatsPeriod    `json:"today"`
+	Week     *StatsPeriod    `json:"week"`
+	Month    *StatsPeriod    `json:"month"`
+	AllTime  *StatsPeriod    `json:"all_time"`
+	Daily    []*StatsPeriod  `json:"daily"`
+	Weekly   []*StatsPeriod  `json:"weekly"`
+	Monthly  []*StatsPeriod  `json:"monthly"`
+	Torrents []*StatsTorrent `json:"torrents"`
+	Quota    *QuotaStatus    `json:"quota"`
+}
+
+func (p *StatsPeriod) add(downloaded, uploaded int64) {
+	p.Downloaded += downloaded
+	p.Uploaded += uploaded
+	p.Ratio = statsRatio(p.Downloaded, p.Uploaded)
+}
+
+func statsRatio(downloaded, uploaded int64) float64 {
+	if downloaded <= 0 {
+		return 0
+	}
+	return float64(uploaded) / float64(downloaded)
+}
+
+func (s *Service) watchStats() {
+	defer s.wg.Done()
+
+	closing := s.Closer.C()
+	ticker := time.NewTicker(statsInterval)
+	defer ticker.Stop()
+
+	// Throttling should be restored right after restart
+	s.checkQuota()
+
+	for {
+		select {
+		case <-closing:
+			// Store what was transferred since last sample, session is still alive
+			s.recordStats(s.GetTorrents()...)
+			return
+
+		case <-ticker.C:
+			s.recordStats(s.GetTorrents()...)
+			s.checkQuota()
+		}
+	}
+}
+
+// recordStats saves current counters of torrents to the database
+func (s *Service) recordStats(torrents ...*Torrent) {
+	if database.WritesSuspended() {
+		return
+	}
+
+	samples := make([]database.TransferSample, 0, len(torrents))
+	for _, t := range torrents {
+		if t == nil || t.IsPreview || t.th == nil || t.th.Swigcptr() == 0 {
+			continue
+		}
+
+		ts := t.GetLastStatus(false)
+		if ts == nil || ts.Swigcptr() == 0 {
+			continue
+		}
+
+		samples = append(samples, database.TransferSample{
+			InfoHash:   t.InfoHash(),
+			Name:       t.Name(),
+			Downloaded: ts.GetAllTimeDownload(),
+			Uploaded:   ts.GetAllTimeUpload(),
+			// Torrents, loaded on startup, have counters from previous sessions
+			Baseline: time.Since(t.GetAddedTime()) > 2*statsInterval,
+		})
+	}
+
+	if err := database.GetStorm().AddTransferStats(samples); err != nil {
+		log.Warningf("Could not save transfer stats: %s", err)
+	}
+}
+
+// GetStats returns transfer history, aggregated by days, weeks and months
+func (s *Service) GetStats() (*Stats, error) {
+	// Include transfers since last sample
+	s.recordStats(s.GetTorrents()...)
+
+	days, err := database.GetStorm().GetTransferStats()
+	if err != nil {
+		return nil, err
+	}
+	torrents, err := database.GetStorm().GetTorrentTransferStats()
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	today := now.Format(database.TransferStatsDayFormat)
+	weekStart := now.AddDate(0, 0, -6).Format(database.TransferStatsDayFormat)
+	monthStart := now.AddDate(0, 0, -29).Format(database.TransferStatsDayFormat)
+
+	ret := &Stats{
+		Today:    &StatsPeriod{Period: "today"},
+		Week:     &StatsPeriod{Period: "week"},
+		Month:    &StatsPeriod{Period: "month"},
+		AllTime:  &StatsPeriod{Period: "all_time"},
+		Daily:    []*StatsPeriod{},
+		Weekly:   []*StatsPeriod{},
+		Monthly:  []*StatsPeriod{},
+		Torrents: []*StatsTorrent{},
+		Quota:    s.GetQuotaStatus(),
+	}
+
+	// Days are sorted, so iterating backwards gives recent periods first
+	for i := len(days) - 1; i >= 0; i-- {
+		d := days[i]
+		dt, err := time.ParseInLocation(database.TransferStatsDayFormat, d.Day, time.Local)
+		if err != nil {
+			continue
+		}
+
+		if d.Day == today {
+			ret.Today.add(d.Downloaded, d.Uploaded)
+		}
+		if d.Day >= weekStart {
+			ret.Week.add(d.Downloaded, d.Uploaded)
+		}
+		if d.Day >= monthStart {
+			ret.Month.add(d.Downloaded, d.Uploaded)
+		}
+		ret.AllTime.add(d.Downloaded, d.Uploaded)
+
+		if len(ret.Daily) < statsDailyPeriods {
+			period := &StatsPeriod{Period: d.Day}
+			period.add(d.Downloaded, d.Uploaded)
+			ret.Daily = append(ret.Daily, period)
+		}
+
+		year, week := dt.ISOWeek()
+		ret.Weekly = addStatsPeriod(ret.Weekly, fmt.Sprintf("%d-W%02d", year, week), d)
+		ret.Monthly = addStatsPeriod(ret.Monthly, dt.Format("2006-01"), d)
+	}
+	if len(ret.Weekly) > statsWeeklyPeriods {
+		ret.Weekly = ret.Weekly[:statsWeeklyPeriods]
+	}
+
+	for _, t := range torrents {
+		ret.Torrents = append(ret.Torrents, &StatsTorrent{
+			InfoHash:   t.InfoHash,
+			Name:       t.Name,
+			Downloaded: t.Downloaded,
+			Uploaded:   t.Uploaded,
+			Ratio:      statsRatio(t.Downloaded, t.Uploaded),
+			Active:     s.GetTorrentByHash(t.InfoHash) != nil,
+			Added:      t.Added,
+			Updated:    t.Updated,
+		})
+	}
+
+	return ret, nil
+}
+
+// addStatsPeriod adds day to the last period, or starts a new one
+func addStatsPeriod(periods []*StatsPeriod, name string, d database.TransferStats) []*StatsPeriod {
+	if len(periods) == 0 || periods[len(periods)-1].Period != name {
+		periods = append(periods, &StatsPeriod{Period: name})
+	}
+	periods[len(periods)-1].add(d.Downloaded, d.Uploaded)
+	return periods
+}
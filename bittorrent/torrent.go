@@ -46,10 +46,11 @@ type Torrent struct {
 	ms                lt.MemoryStorage
 	fastResumeFile    string
 	torrentFile       string
-	partsFile         string
 	memoryStorageFile string
 	fileStorageFile   string
 	addedTime         time.Time
+	savePath          string
+	category          string
 	DownloadStorage   int
 
 	title              string
@@ -76,7 +77,20 @@ type Torrent struct {
 	BufferPiecesProgress   map[int]float64
 	MemorySize             int64
 
+	bufferPre  PieceRange
+	bufferPost PieceRange
+
+	containerIndexes  map[int]*ContainerIndex
+	containerWatchers map[int]bool
+	muContainer       *sync.Mutex
+
+	playlist        []*PlaylistItem
+	playlistKey     string
+	playlistUpdated time.Time
+	muPlaylist      *sync.Mutex
+
 	IsMoveInProgress         bool
+	IsRemoveInProgress       bool
 	IsMarkedToMove           bool
 	IsPlaying                bool
 	IsPaused                 bool
@@ -88,6 +102,9 @@ type Torrent struct {
 	IsNeedFinishNotification bool
 	HasNextFile              bool
 	PlayerAttached           int
+	IsQueued                 bool
+	IsPreview                bool
+	IsRenamed                bool
 
 	DBItem *database.BTItem
 
@@ -142,12 +159,17 @@ func NewTorrent(service *Service, handle lt.TorrentHandle, info lt.TorrentInfo,
 		BufferPiecesProgress: map[int]float64{},
 		BufferProgress:       -1,
 
+		containerIndexes:  map[int]*ContainerIndex{},
+		containerWatchers: map[int]bool{},
+
 		mu:               &sync.Mutex{},
 		muBuffer:         &sync.RWMutex{},
 		muReaders:        &sync.Mutex{},
 		muAwaitingPieces: &sync.RWMutex{},
 		muDemandPieces:   &sync.RWMutex{},
 		muStatus:         &sync.Mutex{},
+		muContainer:      &sync.Mutex{},
+		muPlaylist:       &sync.Mutex{},
 	}
 
 	return t
@@ -349,6 +371,69 @@ func (t *Torrent) GetHumanizedSpeeds() (down, up string) {
 	return humanize.Bytes(uint64(downInt)), humanize.Bytes(uint64(upInt))
 }
 
+// SetLimits applies per-torrent download/upload rate limits (bytes/s)
+// and connections cap, and saves them into the database. 0 means unlimited.
+func (t *Torrent) SetLimits(downloadLimit, uploadLimit, maxConnections int) {
+	if t.Closer.IsSet() || t.th == nil || t.th.Swigcptr() == 0 {
+		return
+	}
+
+	t.applyLimits(downloadLimit, uploadLimit, maxConnections)
+
+	if err := database.GetStorm().UpdateBTItemLimits(t.infoHash, downloadLimit, uploadLimit, maxConnections); err != nil {
+		log.Warningf("Could not save limits for torrent %s: %s", t.infoHash, err)
+	}
+	t.FetchDBItem()
+}
+
+// RestoreLimits applies per-torrent limits, stored in the database
+func (t *Torrent) RestoreLimits() {
+	if t.DBItem == nil || (t.DBItem.DownloadLimit == 0 && t.DBItem.UploadLimit == 0 && t.DBItem.MaxConnections == 0) {
+		return
+	}
+
+	t.applyLimits(t.DBItem.DownloadLimit, t.DBItem.UploadLimit, t.DBItem.MaxConnections)
+}
+
+func (t *Torrent) applyLimits(downloadLimit, uploadLimit, maxConnections int) {
+	log.Infof("Setting limits for torrent %s: download=%s/s, upload=%s/s, connections=%d", t.infoHash, humanize.Bytes(uint64(downloadLimit)), humanize.Bytes(uint64(uploadLimit)), maxConnections)
+
+	t.th.SetDownloadLimit(downloadLimit)
+	t.th.SetUploadLimit(uploadLimit)
+	t.th.SetMaxConnections(maxConnections)
+}
+
+// GetLimits returns per-torrent limits, stored in the database
+func (t *Torrent) GetLimits() (downloadLimit, uploadLimit, maxConnections int) {
+	if t.DBItem == nil {
+		return 0, 0, 0
+	}
+
+	return t.DBItem.DownloadLimit, t.DBItem.UploadLimit, t.DBItem.MaxConnections
+}
+
+// GetEffectiveLimits returns limits that are actually applied to the torrent,
+// taking session-wide limits into account. 0 means unlimited.
+func (t *Torrent) GetEffectiveLimits() (downloadLimit, uploadLimit, maxConnections int) {
+	downloadLimit, uploadLimit, maxConnections = t.GetLimits()
+	if t.Service == nil || t.Service.PackSettings == nil {
+		return
+	}
+
+	downloadLimit = minLimit(downloadLimit, t.Service.PackSettings.GetInt("download_rate_limit"))
+	uploadLimit = minLimit(uploadLimit, t.Service.PackSettings.GetInt("upload_rate_limit"))
+	maxConnections = minLimit(maxConnections, t.Service.PackSettings.GetInt("connections_limit"))
+	return
+}
+
+// GetBufferingState returns whether torrent is buffering, and whether buffering is finished
+func (t *Torrent) GetBufferingState() (isBuffering, isFinished bool) {
+	t.muBuffer.RLock()
+	defer t.muBuffer.RUnlock()
+
+	return t.IsBuffering, t.IsBufferingFinished
+}
+
 func (t *Torrent) bufferFinishedEvent() {
 	t.muBuffer.Lock()
 	log.Infof("Buffer finished: %#v, %#v", t.IsBuffering, t.BufferPiecesProgress)
@@ -381,6 +466,19 @@ func (t *Torrent) Buffer(file *File, isStartup bool) {
 	preBufferStart, preBufferEnd, preBufferOffset, preBufferSize := t.getBufferSize(file.Offset, 0, startBufferSize)
 	postBufferStart, postBufferEnd, postBufferOffset, postBufferSize := t.getBufferSize(file.Offset, file.Size-int64(config.Get().EndBufferSize), int64(config.Get().EndBufferSize))
 
+	// Container index tells exactly which pieces player reads from the end of the file,
+	// without it we fall back to fixed end buffer and look for the index in background.
+	postPieces := []int{}
+	if ci := t.ContainerIndex(file); ci != nil {
+		postPieces = t.indexPieces(file, ci.Ranges)
+		postBufferSize = int64(len(postPieces)) * t.pieceLength
+	} else {
+		for i := postBufferStart; i <= postBufferEnd; i++ {
+			postPieces = append(postPieces, i)
+		}
+		go t.watchContainerIndex(file)
+	}
+
 	// TODO: Remove this piece of buffer adjustment?
 	// if config.Get().AutoAdjustBufferSize && preBufferEnd-preBufferStart < 10 {
 	// 	_, free := t.Service.GetMemoryStats()
@@ -454,9 +552,11 @@ func (t *Torrent) Buffer(file *File, isStartup bool) {
 	for i := preBufferStart; i <= preBufferEnd; i++ {
 		t.BufferPiecesProgress[i] = 0
 	}
-	for i := postBufferStart; i <= postBufferEnd; i++ {
+	for _, i := range postPieces {
 		t.BufferPiecesProgress[i] = 0
 	}
+	t.bufferPre = PieceRange{Begin: preBufferStart, End: preBufferEnd}
+	t.bufferPost = PieceRange{Begin: postBufferStart, End: postBufferEnd}
 
 	t.BufferPiecesLength = 0
 	for range t.BufferPiecesProgress {
@@ -465,10 +565,10 @@ func (t *Torrent) Buffer(file *File, isStartup bool) {
 
 	t.muBuffer.Unlock()
 
-	log.Infof("Setting buffer for file: %s (%s / %s). Desired: %s. Pieces: %#v-%#v + %#v-%#v, PieceLength: %s, Pre: %s, Post: %s, WithOffset: %#v / %#v (%#v)",
+	log.Infof("Setting buffer for file: %s (%s / %s). Desired: %s. Pieces: %#v-%#v + %#v, PieceLength: %s, Pre: %s, Post: %s, WithOffset: %#v / %#v (%#v)",
 		file.Path, humanize.Bytes(uint64(file.Size)), humanize.Bytes(uint64(t.ti.TotalSize())),
 		humanize.Bytes(uint64(t.Service.GetBufferSize())),
-		preBufferStart, preBufferEnd, postBufferStart, postBufferEnd,
+		preBufferStart, preBufferEnd, postPieces,
 		humanize.Bytes(uint64(t.pieceLength)), humanize.Bytes(uint64(preBufferSize)), humanize.Bytes(uint64(postBufferSize)),
 		preBufferOffset, postBufferOffset, file.Offset)
 
@@ -492,7 +592,7 @@ func (t *Torrent) Buffer(file *File, isStartup bool) {
 		for curPiece = preBufferStart; curPiece <= preBufferEnd; curPiece++ { // get this part
 			piecesPriorities.Set(curPiece, 7)
 		}
-		for curPiece = postBufferStart; curPiece <= postBufferEnd; curPiece++ { // get this part
+		for _, curPiece = range postPieces { // get this part
 			piecesPriorities.Set(curPiece, 7)
 		}
 		t.th.PrioritizePieces(piecesPriorities)
@@ -501,7 +601,7 @@ func (t *Torrent) Buffer(file *File, isStartup bool) {
 			t.demandPieces.AddInt(curPiece)
 			t.th.PiecePriority(curPiece, 3)
 		}
-		for curPiece = postBufferStart; curPiece <= postBufferEnd; curPiece++ { // get this part
+		for _, curPiece = range postPieces { // get this part
 			t.demandPieces.AddInt(curPiece)
 			t.th.PiecePriority(curPiece, 3)
 		}
@@ -525,7 +625,7 @@ func (t *Torrent) Buffer(file *File, isStartup bool) {
 		for curPiece = preBufferStart; curPiece <= preBufferEnd; curPiece++ { // get this part
 			t.th.SetPieceDeadline(curPiece, 0, 0)
 		}
-		for curPiece = postBufferStart; curPiece <= postBufferEnd; curPiece++ { // get this part
+		for _, curPiece = range postPieces { // get this part
 			t.th.SetPieceDeadline(curPiece, 0, 0)
 		}
 	}
@@ -827,6 +927,8 @@ func (t *Torrent) GetSmartState() int {
 
 	if t.Service.Session.IsPaused() {
 		return StatusPaused
+	} else if t.IsQueued {
+		return StatusQueued
 	} else if torrentStatus.GetPaused() && state != StatusFinished && state != StatusFinding {
 		if progress == 100 {
 			return StatusFinished
@@ -1224,10 +1326,11 @@ func (t *Torrent) Drop(removeFiles, removeData bool) {
 				defer os.Remove(t.fastResumeFile)
 			}
 
-			// Removing .parts file
-			if _, err := os.Stat(t.partsFile); err == nil {
-				log.Infof("Deleting parts file at %s", t.partsFile)
-				defer os.Remove(t.partsFile)
+			// Removing .parts file, it is stored next to torrent files
+			partsFile := t.partsFilePath()
+			if _, err := os.Stat(partsFile); err == nil {
+				log.Infof("Deleting parts file at %s", partsFile)
+				defer os.Remove(partsFile)
 			}
 
 			// Removing .memory/.file file
@@ -1257,6 +1360,7 @@ func (t *Torrent) Pause() {
 	t.th.Pause()
 
 	t.IsPaused = true
+	t.IsQueued = false
 }
 
 // Resume ...
@@ -1271,6 +1375,143 @@ func (t *Torrent) Resume() {
 	t.th.Resume()
 
 	t.IsPaused = false
+	t.IsQueued = false
+}
+
+// ForceRecheck verifies downloaded data against piece hashes,
+// torrent stays in checking state, with progress of the check, until it is done.
+func (t *Torrent) ForceRecheck() error {
+	if t.Closer.IsSet() || t.th == nil || t.th.Swigcptr() == 0 {
+		return errors.New("Torrent is not available")
+	} else if !t.HasMetadata() {
+		return errors.New("Torrent has no metadata")
+	} else if t.IsMemoryStorage() {
+		return errors.New("Torrent uses memory storage")
+	} else if t.IsMoveInProgress {
+		return errors.New("Torrent files are being moved")
+	}
+
+	log.Infof("Forcing recheck of torrent: %s", t.InfoHash())
+	t.th.ForceRecheck()
+
+	return nil
+}
+
+// IsChecking returns whether torrent data is being checked
+func (t *Torrent) IsChecking() bool {
+	checking, _ := t.CheckProgress()
+	return checking
+}
+
+// CheckProgress returns whether torrent data is being checked, and progress of the check,
+// while checking libtorrent reports progress of the check instead of download progress.
+func (t *Torrent) CheckProgress() (bool, float64) {
+	if t.Closer.IsSet() || t.th == nil || t.th.Swigcptr() == 0 {
+		return false, 0
+	}
+
+	st := t.GetStatus()
+	defer lt.DeleteTorrentStatus(st)
+
+	state := st.GetState()
+	if state != lt.TorrentStatusCheckingFiles && state != lt.TorrentStatusCheckingResumeData {
+		return false, 0
+	}
+	return true, float64(st.GetProgress()) * 100
+}
+
+// queue pauses torrent, waiting for a free slot in the queue
+func (t *Torrent) queue() {
+	if t.Closer.IsSet() {
+		return
+	}
+
+	log.Infof("Queueing torrent: %s", t.InfoHash())
+
+	t.th.AutoManaged(false)
+	t.th.Pause()
+
+	t.IsQueued = true
+}
+
+// unqueue starts torrent, that was waiting in the queue
+func (t *Torrent) unqueue() {
+	if t.Closer.IsSet() {
+		return
+	}
+
+	log.Infof("Starting queued torrent: %s", t.InfoHash())
+
+	t.th.AutoManaged(true)
+	t.th.Resume()
+
+	t.IsQueued = false
+}
+
+// GetSeedPolicy returns per-torrent seeding policy, or the one from torrent category,
+// or the one from global settings
+func (t *Torrent) GetSeedPolicy() database.SeedPolicy {
+	if t.DBItem != nil && t.DBItem.SeedPolicy != nil {
+		return *t.DBItem.SeedPolicy
+	}
+	if c := t.Service.GetCategory(t.GetCategory()); c != nil && c.SeedPolicy != nil {
+		return *c.SeedPolicy
+	}
+
+	return database.SeedPolicy{
+		SeedForever:        t.Service.config.SeedForever,
+		SeedTimeLimit:      t.Service.config.SeedTimeLimit,
+		SeedTimeRatioLimit: t.Service.config.SeedTimeRatioLimit,
+		ShareRatioLimit:    t.Service.config.ShareRatioLimit,
+		EndAction:          t.Service.config.SeedEndAction,
+	}
+}
+
+// SetSeedPolicy saves per-torrent seeding policy, nil resets to global settings
+func (t *Torrent) SetSeedPolicy(policy *database.SeedPolicy) {
+	if err := database.GetStorm().UpdateBTItemSeedPolicy(t.infoHash, policy); err != nil {
+		log.Warningf("Could not save seeding policy for torrent %s: %s", t.infoHash, err)
+	}
+	t.FetchDBItem()
+}
+
+// seedLimitReached checks seeding policy and returns the reason if any limit is reached
+func (t *Torrent) seedLimitReached(ts lt.TorrentStatus, seedingTime int) string {
+	policy := t.GetSeedPolicy()
+	if t.IsMemoryStorage() || policy.SeedForever {
+		return ""
+	}
+
+	if policy.SeedTimeLimit > 0 && seedingTime >= policy.SeedTimeLimit {
+		return "Seeding time limit reached"
+	}
+	if policy.SeedTimeRatioLimit > 0 {
+		timeRatio := 0
+		downloadTime := ts.GetActiveTime() - seedingTime
+		if downloadTime > 1 {
+			timeRatio = seedingTime * 100 / downloadTime
+		}
+		if timeRatio >= policy.SeedTimeRatioLimit {
+			return "Seeding time ratio reached"
+		}
+	}
+	if policy.ShareRatioLimit > 0 {
+		ratio := int64(0)
+		allTimeDownload := ts.GetAllTimeDownload()
+		if allTimeDownload > 0 {
+			ratio = ts.GetAllTimeUpload() * 100 / allTimeDownload
+		}
+		if ratio >= int64(policy.ShareRatioLimit) {
+			return "Share ratio reached"
+		}
+	}
+
+	return ""
+}
+
+// GetQueuePosition returns 1-based position in the session queue
+func (t *Torrent) GetQueuePosition() int {
+	return t.Service.q.Position(t)
 }
 
 // GetDBItem ...
@@ -1345,6 +1586,8 @@ func (t *Torrent) CloseReaders() {
 
 // ResetReaders ...
 func (t *Torrent) ResetReaders() {
+	playing, duration := t.playingDuration()
+
 	t.muReaders.Lock()
 	defer t.muReaders.Unlock()
 
@@ -1399,6 +1642,14 @@ func (t *Torrent) ResetReaders() {
 			size = sizeHead
 		} else if !r.IsActive() {
 			size = sizeIdle
+		} else if want := r.adaptiveReadahead(playing, duration); want > 0 {
+			// Bitrate tells how much readahead holds enough of playback
+			if want < 2*t.pieceLength {
+				want = 2 * t.pieceLength
+			}
+			if !t.IsMemoryStorage() || want < size {
+				size = want
+			}
 		}
 
 		if r.readahead == size {
@@ -1445,6 +1696,7 @@ func (t *Torrent) MakeFiles() {
 	numFiles := t.ti.NumFiles()
 	files := t.ti.Files()
 	t.files = []*File{}
+	t.resetPlaylist()
 
 	for i := 0; i < numFiles; i++ {
 		pr := t.GetFilePieces(files, i)
@@ -1543,10 +1795,14 @@ func (t *Torrent) onMetadataReceived() {
 	// Reset fastResumeFile
 	infoHash := t.InfoHash()
 	t.fastResumeFile = filepath.Join(t.Service.config.TorrentsPath, fmt.Sprintf("%s.fastresume", infoHash))
-	t.partsFile = filepath.Join(t.Service.config.DownloadPath, fmt.Sprintf(".%s.parts", infoHash))
 	t.memoryStorageFile = filepath.Join(t.Service.config.TorrentsPath, fmt.Sprintf(".%s.memory", infoHash))
 	t.fileStorageFile = filepath.Join(t.Service.config.TorrentsPath, fmt.Sprintf(".%s.file", infoHash))
 
+	// Preview torrents should not be restored after restart
+	if t.IsPreview {
+		return
+	}
+
 	go func() {
 		if t.IsMemoryStorage() {
 			os.Create(t.memoryStorageFile)
@@ -2337,6 +2593,16 @@ func peerNumToString(num int) string {
 	return strconv.Itoa(num)
 }
 
+// minLimit returns the most restrictive of two limits, where 0 means unlimited
+func minLimit(a, b int) int {
+	if a <= 0 {
+		return max(b, 0)
+	} else if b <= 0 {
+		return a
+	}
+	return min(a, b)
+}
+
 func min(a, b int) int {
 	if a < b {
 		return a
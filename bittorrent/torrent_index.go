@@ -0,0 +1,253 @@
+package bittorrent
+
+import (
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+
+	"github.com/dustin/go-humanize"
+)
+
+const (
+	containerIndexInterval = 500 * time.Millisecond
+	containerIndexTimeout  = 5 * time.Minute
+)
+
+// pieceReader reads file data only from downloaded pieces, and reports missing ranges otherwise
+type pieceReader struct {
+	t *Torrent
+	f *File
+}
+
+// ReadAt ...
+func (pr *pieceReader) ReadAt(p []byte, off int64) (int, error) {
+	if off < 0 || off >= pr.f.Size {
+		return 0, io.EOF
+	}
+
+	length := int64(len(p))
+	if off+length > pr.f.Size {
+		length = pr.f.Size - off
+		p = p[:length]
+	}
+	if length == 0 {
+		return 0, io.EOF
+	}
+
+	start := pr.f.Offset + off
+	for piece := int(start / pr.t.pieceLength); piece <= int((start+length-1)/pr.t.pieceLength); piece++ {
+		if !pr.t.hasPiece(piece) {
+			return 0, &missingRangeError{Offset: off, Length: length}
+		}
+	}
+
+	var n int
+	if pr.t.IsMemoryStorage() {
+		if pr.t.ms == nil {
+			return 0, errors.New("Memory storage is not initialized")
+		}
+
+		for n < len(p) {
+			abs := start + int64(n)
+			piece := int(abs / pr.t.pieceLength)
+			pieceOffset := int(abs % pr.t.pieceLength)
+			size := min(len(p)-n, int(pr.t.pieceLength)-pieceOffset)
+
+			// Piece could be already evicted from memory
+			if pr.t.ms.Read(p[n:n+size], size, piece, pieceOffset) != size {
+				return n, &missingRangeError{Offset: off, Length: length}
+			}
+			n += size
+		}
+	} else {
+		fh, err := os.Open(filepath.Join(pr.t.GetSavePath(), pr.f.Path))
+		if err != nil {
+			return 0, err
+		}
+		defer fh.Close()
+
+		if n, err = fh.ReadAt(p, off); err != nil {
+			return n, err
+		}
+	}
+
+	if length < int64(len(p)) {
+		return n, io.EOF
+	}
+	return n, nil
+}
+
+// ContainerIndex returns parsed index of the file, if it is known
+func (t *Torrent) ContainerIndex(file *File) *ContainerIndex {
+	if file == nil {
+		return nil
+	}
+
+	t.muContainer.Lock()
+	defer t.muContainer.Unlock()
+
+	return t.containerIndexes[file.Index]
+}
+
+// watchContainerIndex parses container index of the file, as soon as needed pieces arrive,
+// and prioritizes pieces, that parser asks for: moov box of MP4, SeekHead and Cues of MKV.
+func (t *Torrent) watchContainerIndex(file *File) {
+	if file == nil || !isContainerSupported(file.Name) || t.pieceLength <= 0 {
+		return
+	}
+
+	t.muContainer.Lock()
+	if t.containerIndexes[file.Index] != nil || t.containerWatchers[file.Index] {
+		t.muContainer.Unlock()
+		return
+	}
+	t.containerWatchers[file.Index] = true
+	t.muContainer.Unlock()
+
+	defer func() {
+		t.muContainer.Lock()
+		delete(t.containerWatchers, file.Index)
+		t.muContainer.Unlock()
+	}()
+
+	closing := t.Closer.C()
+	ticker := time.NewTicker(containerIndexInterval)
+	defer ticker.Stop()
+	timeout := time.After(containerIndexTimeout)
+
+	for {
+		ci, err := parseContainerIndex(&pieceReader{t: t, f: file}, file.Name, file.Size)
+
+		var missing *missingRangeError
+		if err == nil {
+			t.setContainerIndex(file, ci)
+			return
+		} else if errors.As(err, &missing) {
+			t.prioritizeIndexPieces(t.indexPieces(file, []ByteRange{{Start: missing.Offset, End: missing.Offset + missing.Length}}))
+		} else {
+			log.Infof("Could not parse container index of %s: %s", file.Name, err)
+			return
+		}
+
+		select {
+		case <-closing:
+			return
+		case <-timeout:
+			log.Infof("Could not get container index of %s in time", file.Name)
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func (t *Torrent) setContainerIndex(file *File, ci *ContainerIndex) {
+	pieces := t.indexPieces(file, ci.Ranges)
+
+	t.muContainer.Lock()
+	t.containerIndexes[file.Index] = ci
+	t.muContainer.Unlock()
+
+	log.Infof("Container index of %s: %s, duration %s, bitrate %s/s, seek points %d, index pieces %v",
+		file.Name, ci.Format, ci.Duration.Round(time.Second), humanize.Bytes(uint64(ci.Bitrate())), len(ci.points), pieces)
+
+	// Other elements, the player reads, are not needed to parse the index
+	t.prioritizeIndexPieces(pieces)
+	t.bufferIndexPieces(pieces)
+	t.ResetReaders()
+}
+
+// indexPieces returns sorted pieces, containing ranges of the file
+func (t *Torrent) indexPieces(file *File, ranges []ByteRange) []int {
+	seen := map[int]bool{}
+	ret := []int{}
+	for _, r := range ranges {
+		if r.End <= r.Start {
+			continue
+		}
+
+		start := int((file.Offset + r.Start) / t.pieceLength)
+		end := int((file.Offset + r.End - 1) / t.pieceLength)
+		for piece := start; piece <= end && piece < t.pieceCount; piece++ {
+			if !seen[piece] {
+				seen[piece] = true
+				ret = append(ret, piece)
+			}
+		}
+	}
+
+	sort.Ints(ret)
+	return ret
+}
+
+// prioritizeIndexPieces requests index pieces with the highest priority,
+// memory storage keeps them as reserved, since player reads them again on seeks.
+func (t *Torrent) prioritizeIndexPieces(pieces []int) {
+	if t.Closer.IsSet() || t.th == nil || len(pieces) == 0 {
+		return
+	}
+
+	t.muDemandPieces.Lock()
+	defer t.muDemandPieces.Unlock()
+
+	for _, piece := range pieces {
+		if t.IsMemoryStorage() && !containsInt(t.reservedPieces, piece) {
+			t.reservedPieces = append(t.reservedPieces, piece)
+		}
+		if t.demandPieces.ContainsInt(piece) || t.hasPiece(piece) {
+			continue
+		}
+
+		t.demandPieces.AddInt(piece)
+		t.th.PiecePriority(piece, 7)
+		if !t.IsMemoryStorage() {
+			t.th.SetPieceDeadline(piece, 0, 0)
+		}
+	}
+}
+
+// bufferIndexPieces replaces fixed end buffer with index pieces, if buffering is still in progress
+func (t *Torrent) bufferIndexPieces(pieces []int) {
+	t.muBuffer.Lock()
+	defer t.muBuffer.Unlock()
+
+	if !t.IsBuffering || len(t.BufferPiecesProgress) == 0 {
+		return
+	}
+
+	isIndex := map[int]bool{}
+	for _, piece := range pieces {
+		isIndex[piece] = true
+		if _, ok := t.BufferPiecesProgress[piece]; !ok {
+			t.BufferPiecesProgress[piece] = 0
+		}
+	}
+	for piece := t.bufferPost.Begin; piece <= t.bufferPost.End; piece++ {
+		if !isIndex[piece] && (piece < t.bufferPre.Begin || piece > t.bufferPre.End) {
+			delete(t.BufferPiecesProgress, piece)
+		}
+	}
+
+	t.BufferPiecesLength = int64(len(t.BufferPiecesProgress)) * t.pieceLength
+	t.BufferLength = t.BufferPiecesLength
+}
+
+// timeAt returns playback time of the reader offset, if container index is known
+func (tf *TorrentFSEntry) timeAt(offset int64) (time.Duration, bool) {
+	ci := tf.t.ContainerIndex(tf.f)
+	if ci == nil {
+		return 0, false
+	}
+	return ci.TimeAt(offset), true
+}
+
+func containsInt(list []int, v int) bool {
+	for _, i := range list {
+		if i == v {
+			return true
+		}
+	}
+	return false
+}
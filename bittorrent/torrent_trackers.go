@@ -0,0 +1,218 @@
+package bittorrent
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"strings"
+
+	lt "github.com/ElementumOrg/libtorrent-go"
+
+	"github.com/elgatito/elementum/config"
+	"github.com/elgatito/elementum/database"
+)
+
+// GetTrackers returns torrent trackers with announce state
+func (t *Torrent) GetTrackers() []*DetailsTracker {
+	if t.th == nil || t.th.Swigcptr() == 0 {
+		return []*DetailsTracker{}
+	}
+
+	return t.detailsTrackers()
+}
+
+// AddTrackers appends trackers to a new tier after existing ones
+func (t *Torrent) AddTrackers(urls []string) error {
+	trackers, tiers := t.trackerList()
+
+	tier := 0
+	for _, i := range tiers {
+		if i >= tier {
+			tier = i + 1
+		}
+	}
+
+	for _, u := range urls {
+		u = strings.TrimSpace(u)
+		if err := validateTrackerURL(u); err != nil {
+			return err
+		}
+		if indexOfTracker(trackers, u) < 0 {
+			trackers = append(trackers, u)
+			tiers = append(tiers, tier)
+		}
+	}
+
+	return t.setTrackers(trackers, tiers)
+}
+
+// RemoveTracker removes tracker from torrent trackers list
+func (t *Torrent) RemoveTracker(u string) error {
+	trackers, tiers := t.trackerList()
+	idx := indexOfTracker(trackers, u)
+	if idx < 0 {
+		return fmt.Errorf("Tracker not found: %s", u)
+	}
+
+	return t.setTrackers(append(trackers[:idx], trackers[idx+1:]...), append(tiers[:idx], tiers[idx+1:]...))
+}
+
+// MoveTracker moves tracker to a new position in torrent trackers list,
+// tracker takes the tier of the one at that position, since libtorrent keeps trackers sorted by tier.
+func (t *Torrent) MoveTracker(u string, position int) error {
+	trackers, tiers := t.trackerList()
+	idx := indexOfTracker(trackers, u)
+	if idx < 0 {
+		return fmt.Errorf("Tracker not found: %s", u)
+	}
+
+	if position < 0 {
+		position = 0
+	} else if position >= len(trackers) {
+		position = len(trackers) - 1
+	}
+	tier := tiers[position]
+
+	trackers = append(trackers[:idx], trackers[idx+1:]...)
+	tiers = append(tiers[:idx], tiers[idx+1:]...)
+	trackers = append(trackers[:position], append([]string{u}, trackers[position:]...)...)
+	tiers = append(tiers[:position], append([]int{tier}, tiers[position:]...)...)
+
+	return t.setTrackers(trackers, tiers)
+}
+
+// Reannounce forces announce to all trackers
+func (t *Torrent) Reannounce() error {
+	if t.th == nil || t.th.Swigcptr() == 0 {
+		return errors.New("Torrent is not available")
+	}
+
+	log.Infof("Forcing reannounce for %s", t.Name())
+	t.th.ForceReannounce()
+
+	return nil
+}
+
+// ReannounceTracker forces announce to one tracker
+func (t *Torrent) ReannounceTracker(u string) error {
+	if t.th == nil || t.th.Swigcptr() == 0 {
+		return errors.New("Torrent is not available")
+	}
+
+	idx := indexOfTracker(t.trackerURLs(), u)
+	if idx < 0 {
+		return fmt.Errorf("Tracker not found: %s", u)
+	}
+
+	log.Infof("Forcing reannounce for %s to %s", t.Name(), u)
+	t.th.ForceReannounce(0, idx)
+
+	return nil
+}
+
+// AnnounceDHT forces announce to DHT
+func (t *Torrent) AnnounceDHT() error {
+	if t.th == nil || t.th.Swigcptr() == 0 {
+		return errors.New("Torrent is not available")
+	} else if config.Get().DisableDHT {
+		return errors.New("DHT is disabled")
+	}
+
+	log.Infof("Forcing DHT announce for %s", t.Name())
+	t.th.ForceDhtAnnounce()
+
+	return nil
+}
+
+// setTrackers replaces torrent trackers and stores the list, so it is restored after restart
+func (t *Torrent) setTrackers(trackers []string, tiers []int) error {
+	if t.th == nil || t.th.Swigcptr() == 0 {
+		return errors.New("Torrent is not available")
+	}
+
+	replaceTrackers(t.th, trackers, tiers)
+
+	if !t.IsPreview {
+		if err := database.GetStorm().UpdateBTItemTrackers(t.infoHash, trackers, tiers); err != nil {
+			return err
+		}
+		t.FetchDBItem()
+
+		t.th.SaveResumeData(1)
+	}
+
+	return nil
+}
+
+func (t *Torrent) trackerURLs() []string {
+	ret, _ := t.trackerList()
+	return ret
+}
+
+// trackerList returns trackers urls with their tiers
+func (t *Torrent) trackerList() (urls []string, tiers []int) {
+	urls = []string{}
+	tiers = []int{}
+	if t.th == nil || t.th.Swigcptr() == 0 {
+		return
+	}
+
+	trackers := t.th.Trackers()
+	defer lt.DeleteStdVectorAnnounceEntry(trackers)
+
+	for i := 0; i < int(trackers.Size()); i++ {
+		entry := trackers.Get(i)
+		urls = append(urls, entry.GetUrl())
+		tiers = append(tiers, int(entry.GetTier()))
+	}
+	return
+}
+
+// replaceTrackers sets trackers list with their tiers,
+// trackers, stored without tiers, keep their order in separate tiers.
+func replaceTrackers(th lt.TorrentHandle, trackers []string, tiers []int) {
+	entries := lt.NewStdVectorAnnounceEntry()
+	defer lt.DeleteStdVectorAnnounceEntry(entries)
+
+	for i, u := range trackers {
+		announceEntry := lt.NewAnnounceEntry(u)
+		defer lt.DeleteAnnounceEntry(announceEntry)
+
+		tier := i
+		if len(tiers) == len(trackers) {
+			tier = tiers[i]
+		}
+		if tier > 255 {
+			tier = 255
+		}
+		announceEntry.SetTier(byte(tier))
+		entries.Add(announceEntry)
+	}
+
+	th.ReplaceTrackers(entries)
+}
+
+func validateTrackerURL(u string) error {
+	parsed, err := url.Parse(u)
+	if err != nil {
+		return fmt.Errorf("Wrong tracker URL %s: %s", u, err)
+	}
+
+	switch parsed.Scheme {
+	case "http", "https", "udp":
+		if parsed.Host == "" {
+			return fmt.Errorf("Wrong tracker URL %s: missing host", u)
+		}
+		return nil
+	}
+	return fmt.Errorf("Wrong tracker URL %s: unsupported scheme", u)
+}
+
+func indexOfTracker(trackers []string, u string) int {
+	for i, t := range trackers {
+		if t == u {
+			return i
+		}
+	}
+	return -1
+}
@@ -43,6 +43,8 @@ type TorrentFSEntry struct {
 	seeked  event.Event
 	removed event.Event
 
+	rate readRate
+
 	id          int64
 	readahead   int64
 	storageType int
@@ -81,7 +83,7 @@ func (tfs *TorrentFS) Open(uname string) (http.File, error) {
 				log.Noticef("%s belongs to torrent %s", name, t.Name())
 
 				if !t.IsMemoryStorage() {
-					file, err = os.Open(filepath.Join(string(tfs.Dir), name))
+					file, err = os.Open(filepath.Join(t.GetSavePath(), name))
 					if err != nil {
 						return nil, err
 					}
@@ -124,6 +126,9 @@ func NewTorrentFSEntry(file http.File, tfs *TorrentFS, t *Torrent, f *File, name
 		isHead:   tfs.isHead,
 	}
 	go tf.consumeAlerts()
+	if !tf.isHead {
+		go t.watchContainerIndex(f)
+	}
 
 	t.muReaders.Lock()
 	t.readers[tf.id] = tf
@@ -185,6 +190,11 @@ func (tf *TorrentFSEntry) Close() error {
 func (tf *TorrentFSEntry) Read(data []byte) (n int, err error) {
 	defer perf.ScopeTimer()()
 	tf.SetActive(true)
+	defer func() {
+		if n > 0 && tf.rate.add(n) {
+			tf.checkReadahead()
+		}
+	}()
 
 	currentOffset, err := tf.File.Seek(0, io.SeekCurrent)
 	if err != nil {
@@ -253,6 +263,8 @@ func (tf *TorrentFSEntry) Seek(offset int64, whence int) (int64, error) {
 
 	switch whence {
 	case io.SeekStart:
+		tf.rate.reset()
+
 		toUpdate := false
 		tf.t.muReaders.Lock()
 		for _, r := range tf.t.readers {
@@ -279,8 +291,18 @@ func (tf *TorrentFSEntry) Seek(offset int64, whence int) (int64, error) {
 		seekingOffset = tf.f.Size - offset
 	}
 
-	log.Infof("Seeking at %d... with %d", seekingOffset, whence)
-	return tf.File.Seek(offset, whence)
+	if ts, ok := tf.timeAt(seekingOffset); ok {
+		log.Infof("Seeking at %d (%s)... with %d", seekingOffset, ts.Round(time.Second), whence)
+	} else {
+		log.Infof("Seeking at %d... with %d", seekingOffset, whence)
+	}
+
+	ret, err := tf.File.Seek(offset, whence)
+	if err == nil && whence == io.SeekStart && tf.t.ContainerIndex(tf.f) != nil {
+		// Readahead depends on bitrate at the new position
+		tf.t.ResetReaders()
+	}
+	return ret, err
 }
 
 func (tf *TorrentFSEntry) waitForPiece(piece int) error {
@@ -154,6 +154,26 @@ func byPath(l, r *File) bool {
 	return l.Path < r.Path
 }
 
+const (
+	// QueueUp ...
+	QueueUp = iota
+	// QueueDown ...
+	QueueDown
+	// QueueTop ...
+	QueueTop
+	// QueueBottom ...
+	QueueBottom
+)
+
+const (
+	// SeedActionPause ...
+	SeedActionPause = iota
+	// SeedActionRemove ...
+	SeedActionRemove
+	// SeedActionRemoveData ...
+	SeedActionRemoveData
+)
+
 // AddOptions is setting options for different torrent add procedures
 type AddOptions struct {
 	URI             string
@@ -161,6 +181,8 @@ type AddOptions struct {
 	DownloadStorage int
 	FirstTime       bool
 	AddedTime       time.Time
+	Category        string
+	Preview         bool
 }
 
 // RemoveOptions is setting options for different torrent removal procedures
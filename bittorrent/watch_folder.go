@@ -0,0 +1,227 @@
+package bittorrent
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/radovskyb/watcher"
+
+	"github.com/elgatito/elementum/config"
+	"github.com/elgatito/elementum/database"
+	"github.com/elgatito/elementum/util"
+)
+
+const (
+	watchFolderProcessed = "processed"
+	watchFolderFailed    = "failed"
+)
+
+// startWatchFolder watches configured folder for new .torrent and .magnet files
+func (s *Service) startWatchFolder() {
+	if !s.config.WatchFolderEnabled || s.config.WatchFolderPath == "" {
+		return
+	}
+
+	path := s.config.WatchFolderPath
+	if err := util.IsWritablePath(path); err != nil {
+		log.Errorf("Cannot use watch folder %s: %s", path, err)
+		return
+	}
+	for _, dir := range []string{watchFolderProcessed, watchFolderFailed} {
+		if err := os.MkdirAll(filepath.Join(path, dir), 0755); err != nil {
+			log.Errorf("Cannot create watch folder subdirectory: %s", err)
+			return
+		}
+	}
+
+	w := watcher.New()
+	w.FilterOps(watcher.Create, watcher.Rename, watcher.Move)
+	w.IgnoreHiddenFiles(true)
+	if err := w.Add(path); err != nil {
+		log.Errorf("Watcher error. Could not add watch folder %s: %s", path, err)
+		return
+	}
+
+	s.muWatchFolder.Lock()
+	s.watchFolder = w
+	s.muWatchFolder.Unlock()
+
+	log.Infof("Watching folder %s for new torrents", path)
+
+	go func() {
+		closing := s.Closer.C()
+
+		// Process files, that were added while we were not running,
+		// files, created after watcher start, could come with events as well.
+		if files, err := os.ReadDir(path); err == nil {
+			for _, f := range files {
+				if !f.IsDir() {
+					go s.processWatchFolderFile(filepath.Join(path, f.Name()))
+				}
+			}
+		}
+
+		for {
+			select {
+			case event := <-w.Event:
+				if event.IsDir() || filepath.Dir(event.Path) != filepath.Clean(path) {
+					continue
+				}
+				go s.processWatchFolderFile(event.Path)
+			case err := <-w.Error:
+				log.Errorf("Watch folder error: %s", err)
+			case <-w.Closed:
+				return
+			case <-closing:
+				w.Close()
+				return
+			}
+		}
+	}()
+
+	go func() {
+		if err := w.Start(time.Second * 2); err != nil {
+			log.Errorf("Error watching folder %s: %s", path, err)
+		}
+	}()
+}
+
+// stopWatchFolder stops watching for new files
+func (s *Service) stopWatchFolder() {
+	s.muWatchFolder.Lock()
+	defer s.muWatchFolder.Unlock()
+
+	if s.watchFolder != nil {
+		log.Info("Stopping watch folder...")
+		s.watchFolder.Close()
+		s.watchFolder = nil
+	}
+}
+
+func (s *Service) processWatchFolderFile(path string) {
+	ext := strings.ToLower(filepath.Ext(path))
+	if ext != ".torrent" && ext != ".magnet" {
+		return
+	}
+
+	// The same file could come from initial scan and from watcher event
+	if !s.startWatchFolderFile(path) {
+		return
+	}
+	defer s.finishWatchFolderFile(path)
+
+	if !util.FileExists(path) {
+		return
+	} else if err := waitFileSettled(path); err != nil {
+		log.Warningf("Skipping watch folder file %s: %s", path, err)
+		return
+	}
+
+	log.Infof("Adding torrent from watch folder: %s", path)
+	if err := s.addWatchFolderFile(path); err != nil {
+		log.Warningf("Could not add torrent from watch folder file %s: %s", path, err)
+		moveWatchFolderFile(path, watchFolderFailed)
+		return
+	}
+
+	moveWatchFolderFile(path, watchFolderProcessed)
+}
+
+// startWatchFolderFile marks file as being processed, returns false if it is already in progress
+func (s *Service) startWatchFolderFile(path string) bool {
+	s.muWatchFolder.Lock()
+	defer s.muWatchFolder.Unlock()
+
+	if s.watchFolderFiles == nil {
+		s.watchFolderFiles = map[string]bool{}
+	}
+	if s.watchFolderFiles[path] {
+		return false
+	}
+
+	s.watchFolderFiles[path] = true
+	return true
+}
+
+func (s *Service) finishWatchFolderFile(path string) {
+	s.muWatchFolder.Lock()
+	defer s.muWatchFolder.Unlock()
+
+	delete(s.watchFolderFiles, path)
+}
+
+func (s *Service) addWatchFolderFile(path string) error {
+	uri := path
+	if strings.ToLower(filepath.Ext(path)) == ".magnet" {
+		dat, err := os.ReadFile(path)
+		if err != nil {
+			return err
+		}
+
+		uri = strings.TrimSpace(string(dat))
+		if !strings.HasPrefix(uri, "magnet:") {
+			return errors.New("File does not contain a magnet link")
+		}
+	}
+
+	torrent := NewTorrentFile(uri)
+	if err := torrent.Resolve(); err == nil && torrent.InfoHash != "" {
+		if t := s.GetTorrentByHash(torrent.InfoHash); t != nil {
+			log.Infof("Torrent %s from %s is already added", t.Name(), path)
+			return nil
+		}
+	}
+
+	t, err := s.AddTorrent(nil, AddOptions{URI: uri, Paused: false, DownloadStorage: config.StorageFile, FirstTime: true, AddedTime: time.Now()})
+	if err != nil {
+		return err
+	} else if t == nil {
+		return errors.New("Torrent was not added")
+	}
+
+	// Create initial BTItem entry and download all the files, since there is nobody to choose
+	database.GetStorm().UpdateBTItem(t.InfoHash(), 0, "", []string{}, t.Name(), 0, 0, 0)
+	t.DownloadAllFiles()
+	t.SaveDBFiles()
+
+	log.Infof("Added torrent %s from watch folder", t.Name())
+	return nil
+}
+
+// waitFileSettled waits until file is not changing, to avoid reading partially written files
+func waitFileSettled(path string) error {
+	var lastSize int64 = -1
+	for i := 0; i < 10; i++ {
+		fi, err := os.Stat(path)
+		if err != nil {
+			return err
+		}
+		if fi.Size() > 0 && fi.Size() == lastSize {
+			return nil
+		}
+
+		lastSize = fi.Size()
+		time.Sleep(500 * time.Millisecond)
+	}
+
+	return fmt.Errorf("File is still being written")
+}
+
+func moveWatchFolderFile(path, dir string) {
+	dest := filepath.Join(filepath.Dir(path), dir, filepath.Base(path))
+	if util.FileExists(dest) {
+		ext := filepath.Ext(dest)
+		dest = fmt.Sprintf("%s.%d%s", strings.TrimSuffix(dest, ext), time.Now().Unix(), ext)
+	}
+
+	if err := os.Rename(path, dest); err != nil {
+		log.Warningf("Could not move watch folder file %s to %s: %s", path, dest, err)
+		return
+	}
+
+	log.Infof("Moved watch folder file %s to %s", path, dest)
+}
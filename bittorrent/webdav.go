@@ -0,0 +1,287 @@
+package bittorrent
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/net/webdav"
+
+	"github.com/elgatito/elementum/util"
+)
+
+// WebDAVFS is read-only webdav.FileSystem with directory tree of active torrents files,
+// files are read through TorrentFS, so reads wait for pieces and move priorities.
+type WebDAVFS struct {
+	tfs *TorrentFS
+
+	once sync.Once
+	root *webdavNode
+}
+
+// webdavNode is a directory or a torrent file in the tree
+type webdavNode struct {
+	name     string
+	t        *Torrent
+	f        *File
+	modTime  time.Time
+	children map[string]*webdavNode
+}
+
+// webdavFile opens TorrentFS entry only on first read, since PROPFIND opens every listed file
+type webdavFile struct {
+	fs    *WebDAVFS
+	node  *webdavNode
+	entry http.File
+	pos   int64
+
+	children []os.FileInfo
+}
+
+type webdavFileInfo struct {
+	node *webdavNode
+}
+
+// NewWebDAVFS ...
+func NewWebDAVFS(service *Service, method string) *WebDAVFS {
+	return &WebDAVFS{
+		tfs: NewTorrentFS(service, method),
+	}
+}
+
+// Mkdir ...
+func (fs *WebDAVFS) Mkdir(ctx context.Context, name string, perm os.FileMode) error {
+	return os.ErrPermission
+}
+
+// RemoveAll ...
+func (fs *WebDAVFS) RemoveAll(ctx context.Context, name string) error {
+	return os.ErrPermission
+}
+
+// Rename ...
+func (fs *WebDAVFS) Rename(ctx context.Context, oldName, newName string) error {
+	return os.ErrPermission
+}
+
+// OpenFile ...
+func (fs *WebDAVFS) OpenFile(ctx context.Context, name string, flag int, perm os.FileMode) (webdav.File, error) {
+	if flag&(os.O_WRONLY|os.O_RDWR|os.O_CREATE|os.O_TRUNC|os.O_APPEND) != 0 {
+		return nil, os.ErrPermission
+	}
+
+	node := fs.lookup(name)
+	if node == nil {
+		return nil, os.ErrNotExist
+	}
+	return &webdavFile{fs: fs, node: node}, nil
+}
+
+// Stat ...
+func (fs *WebDAVFS) Stat(ctx context.Context, name string) (os.FileInfo, error) {
+	node := fs.lookup(name)
+	if node == nil {
+		return nil, os.ErrNotExist
+	}
+	return &webdavFileInfo{node: node}, nil
+}
+
+func (fs *WebDAVFS) lookup(name string) *webdavNode {
+	node := fs.tree()
+	for _, p := range strings.Split(strings.Trim(name, "/"), "/") {
+		if p == "" {
+			continue
+		}
+		if node = node.children[p]; node == nil {
+			return nil
+		}
+	}
+	return node
+}
+
+// tree builds directories from paths of torrents files, the same way they are stored in download path
+func (fs *WebDAVFS) tree() *webdavNode {
+	fs.once.Do(func() {
+		fs.root = &webdavNode{name: "/", modTime: time.Now(), children: map[string]*webdavNode{}}
+
+		for _, t := range fs.tfs.s.GetTorrents() {
+			if t == nil || t.Closer.IsSet() || !t.HasMetadata() {
+				continue
+			}
+
+			added := t.GetAddedTime()
+			for _, f := range t.files {
+				node := fs.root
+				parts := strings.Split(filepath.ToSlash(f.Path), "/")
+				for i, p := range parts {
+					isFile := i == len(parts)-1
+
+					child, ok := node.children[p]
+					if !ok {
+						child = &webdavNode{name: p, modTime: added}
+						if isFile {
+							child.t = t
+							child.f = f
+						} else {
+							child.children = map[string]*webdavNode{}
+						}
+						node.children[p] = child
+					}
+
+					// Same path in different torrents, first one wins
+					if child.children == nil {
+						break
+					}
+					node = child
+				}
+			}
+		}
+	})
+
+	return fs.root
+}
+
+// Close ...
+func (wf *webdavFile) Close() error {
+	if wf.entry != nil {
+		return wf.entry.Close()
+	}
+	return nil
+}
+
+// Read ...
+func (wf *webdavFile) Read(p []byte) (int, error) {
+	if wf.node.f == nil {
+		return 0, errors.New("Is a directory")
+	}
+
+	if wf.entry == nil {
+		entry, err := wf.fs.tfs.Open("/" + util.EncodeFileURL(wf.node.f.Path))
+		if err != nil {
+			return 0, err
+		}
+		wf.entry = entry
+
+		if _, err := wf.entry.Seek(wf.pos, io.SeekStart); err != nil {
+			return 0, err
+		}
+	}
+
+	return wf.entry.Read(p)
+}
+
+// Seek ...
+func (wf *webdavFile) Seek(offset int64, whence int) (int64, error) {
+	if wf.entry != nil {
+		return wf.entry.Seek(offset, whence)
+	}
+
+	pos := offset
+	switch whence {
+	case io.SeekCurrent:
+		pos += wf.pos
+	case io.SeekEnd:
+		if wf.node.f != nil {
+			pos += wf.node.f.Size
+		}
+	}
+	if pos < 0 {
+		return wf.pos, os.ErrInvalid
+	}
+
+	wf.pos = pos
+	return pos, nil
+}
+
+// Readdir ...
+func (wf *webdavFile) Readdir(count int) ([]os.FileInfo, error) {
+	if wf.node.children == nil {
+		return nil, errors.New("Not a directory")
+	}
+
+	if wf.children == nil {
+		names := make([]string, 0, len(wf.node.children))
+		for name := range wf.node.children {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+
+		wf.children = make([]os.FileInfo, 0, len(names))
+		for _, name := range names {
+			wf.children = append(wf.children, &webdavFileInfo{node: wf.node.children[name]})
+		}
+	}
+
+	if count <= 0 {
+		ret := wf.children
+		wf.children = []os.FileInfo{}
+		return ret, nil
+	}
+	if len(wf.children) == 0 {
+		return nil, io.EOF
+	}
+	if count > len(wf.children) {
+		count = len(wf.children)
+	}
+	ret := wf.children[:count]
+	wf.children = wf.children[count:]
+	return ret, nil
+}
+
+// Stat ...
+func (wf *webdavFile) Stat() (os.FileInfo, error) {
+	return &webdavFileInfo{node: wf.node}, nil
+}
+
+// Write ...
+func (wf *webdavFile) Write(p []byte) (int, error) {
+	return 0, os.ErrPermission
+}
+
+// Name ...
+func (fi *webdavFileInfo) Name() string {
+	return fi.node.name
+}
+
+// Size ...
+func (fi *webdavFileInfo) Size() int64 {
+	if fi.node.f != nil {
+		return fi.node.f.Size
+	}
+	return 0
+}
+
+// Mode ...
+func (fi *webdavFileInfo) Mode() os.FileMode {
+	if fi.IsDir() {
+		return os.ModeDir | 0555
+	}
+	return 0444
+}
+
+// ModTime ...
+func (fi *webdavFileInfo) ModTime() time.Time {
+	return fi.node.modTime
+}
+
+// IsDir ...
+func (fi *webdavFileInfo) IsDir() bool {
+	return fi.node.f == nil
+}
+
+// Sys ...
+func (fi *webdavFileInfo) Sys() interface{} {
+	return nil
+}
+
+// ContentType returns type by extension, so listing does not read files to sniff it
+func (fi *webdavFileInfo) ContentType(ctx context.Context) (string, error) {
+	return util.MimeType(fi.node.name), nil
+}
@@ -37,6 +37,7 @@ const (
 	defaultAutoMemorySize        = 40 * 1024 * 1024
 	defaultTraktSyncFrequencyMin = 5
 	defaultEndBufferSize         = 1 * 1024 * 1024
+	defaultReadaheadSeconds      = 60
 	defaultDiskCacheSize         = 12 * 1024 * 1024
 
 	// TraktReadClientID ...
@@ -122,15 +123,20 @@ type Configuration struct {
 	MinCandidateSize            int64
 	MinCandidateShowSize        int64
 	BufferTimeout               int
+	AutoReplaceStalled          bool
 	BufferSize                  int
 	EndBufferSize               int
+	ReadaheadSeconds            int
 	KodiBufferSize              int
 	UploadRateLimit             int
 	DownloadRateLimit           int
 	AutoloadTorrents            bool
 	AutoloadTorrentsPaused      bool
 	LimitAfterBuffering         bool
+	BandwidthScheduleEnabled    bool
 	ConnectionsLimit            int
+	MaxActiveDownloads          int
+	MaxActiveSeeds              int
 	ConnTrackerLimit            int
 	ConnTrackerLimitAuto        bool
 	SessionSave                 int
@@ -139,6 +145,7 @@ type Configuration struct {
 	ShareRatioLimit    int
 	SeedTimeRatioLimit int
 	SeedTimeLimit      int
+	SeedEndAction      int
 
 	DisableUpload            bool
 	DisableLSD               bool
@@ -255,9 +262,36 @@ type Configuration struct {
 	ProxyUseTracker  bool
 	ProxyUseDownload bool
 
-	CompletedMove       bool
-	CompletedMoviesPath string
-	CompletedShowsPath  string
+	CompletedMove            bool
+	CompletedMoviesPath      string
+	CompletedShowsPath       string
+	CompletedRename          bool
+	CompletedRenameInTorrent bool
+	CompletedMovieTemplate   string
+	CompletedShowTemplate    string
+
+	WatchFolderEnabled bool
+	WatchFolderPath    string
+
+	QuotaEnabled         bool
+	QuotaMode            int
+	QuotaResetDay        int
+	QuotaWindow          int
+	QuotaDownload        int64
+	QuotaUpload          int64
+	QuotaThrottlePercent int
+	QuotaThrottleRate    int
+
+	DiskLowSpace      int64
+	DiskCriticalSpace int64
+
+	CleanupEnabled     bool
+	CleanupWatchedDays int
+	CleanupMaxSize     int64
+
+	DLNAEnabled bool
+	DLNAName    string
+	DLNALibrary bool
 
 	LocalOnlyClient bool
 	LogLevel        int
@@ -557,14 +591,17 @@ func Reload() (ret *Configuration, err error) {
 		MinCandidateSize:            int64(settings.ToInt("min_candidate_size") * 1024 * 1024),
 		MinCandidateShowSize:        int64(settings.ToInt("min_candidate_show_size") * 1024 * 1024),
 		BufferTimeout:               settings.ToInt("buffer_timeout"),
+		AutoReplaceStalled:          settings.ToBool("auto_replace_stalled"),
 		BufferSize:                  settings.ToInt("buffer_size") * 1024 * 1024,
 		EndBufferSize:               settings.ToInt("end_buffer_size") * 1024 * 1024,
+		ReadaheadSeconds:            settings.ToInt("readahead_seconds"),
 		UploadRateLimit:             settings.ToInt("max_upload_rate") * 1024,
 		DownloadRateLimit:           settings.ToInt("max_download_rate") * 1024,
 		AutoloadTorrents:            settings.ToBool("autoload_torrents"),
 		AutoloadTorrentsPaused:      settings.ToBool("autoload_torrents_paused"),
 		SpoofUserAgent:              settings.ToInt("spoof_user_agent"),
 		LimitAfterBuffering:         settings.ToBool("limit_after_buffering"),
+		BandwidthScheduleEnabled:    settings.ToBool("bandwidth_schedule_enabled"),
 		DownloadFileStrategy:        settings.ToInt("download_file_strategy"),
 		KeepDownloading:             settings.ToInt("keep_downloading"),
 		KeepFilesPlaying:            settings.ToInt("keep_files_playing"),
@@ -617,6 +654,7 @@ func Reload() (ret *Configuration, err error) {
 		ShareRatioLimit:             settings.ToInt("share_ratio_limit"),
 		SeedTimeRatioLimit:          settings.ToInt("seed_time_ratio_limit"),
 		SeedTimeLimit:               settings.ToInt("seed_time_limit") * 3600,
+		SeedEndAction:               settings.ToInt("seed_end_action"),
 		DisableUpload:               settings.ToBool("disable_upload"),
 		DisableLSD:                  settings.ToBool("disable_lsd"),
 		DisableDHT:                  settings.ToBool("disable_dht"),
@@ -642,6 +680,8 @@ func Reload() (ret *Configuration, err error) {
 		RemoveOriginalTrackers:      settings.ToBool("remove_original_trackers"),
 		ModifyTrackersStrategy:      settings.ToInt("modify_trackers_strategy"),
 		ConnectionsLimit:            settings.ToInt("connections_limit"),
+		MaxActiveDownloads:          settings.ToInt("max_active_downloads"),
+		MaxActiveSeeds:              settings.ToInt("max_active_seeds"),
 		ConnTrackerLimit:            settings.ToInt("conntracker_limit"),
 		ConnTrackerLimitAuto:        settings.ToBool("conntracker_limit_auto"),
 		SessionSave:                 settings.ToInt("session_save"),
@@ -733,9 +773,36 @@ func Reload() (ret *Configuration, err error) {
 		ProxyUseTracker:  settings.ToBool("use_proxy_tracker"),
 		ProxyUseDownload: settings.ToBool("use_proxy_download"),
 
-		CompletedMove:       settings.ToBool("completed_move"),
-		CompletedMoviesPath: settings.ToString("completed_movies_path"),
-		CompletedShowsPath:  settings.ToString("completed_shows_path"),
+		CompletedMove:            settings.ToBool("completed_move"),
+		CompletedMoviesPath:      settings.ToString("completed_movies_path"),
+		CompletedShowsPath:       settings.ToString("completed_shows_path"),
+		CompletedRename:          settings.ToBool("completed_rename"),
+		CompletedRenameInTorrent: settings.ToBool("completed_rename_in_torrent"),
+		CompletedMovieTemplate:   settings.ToString("completed_movie_template"),
+		CompletedShowTemplate:    settings.ToString("completed_show_template"),
+
+		WatchFolderEnabled: settings.ToBool("watch_folder_enabled"),
+		WatchFolderPath:    settings.ToString("watch_folder_path"),
+
+		QuotaEnabled:         settings.ToBool("quota_enabled"),
+		QuotaMode:            settings.ToInt("quota_mode"),
+		QuotaResetDay:        settings.ToInt("quota_reset_day"),
+		QuotaWindow:          settings.ToInt("quota_window"),
+		QuotaDownload:        int64(settings.ToInt("quota_download")) * 1024 * 1024 * 1024,
+		QuotaUpload:          int64(settings.ToInt("quota_upload")) * 1024 * 1024 * 1024,
+		QuotaThrottlePercent: settings.ToInt("quota_throttle_percent"),
+		QuotaThrottleRate:    settings.ToInt("quota_throttle_rate") * 1024,
+
+		DiskLowSpace:      int64(settings.ToInt("disk_low_space")) * 1024 * 1024,
+		DiskCriticalSpace: int64(settings.ToInt("disk_critical_space")) * 1024 * 1024,
+
+		CleanupEnabled:     settings.ToBool("cleanup_enabled"),
+		CleanupWatchedDays: settings.ToInt("cleanup_watched_days"),
+		CleanupMaxSize:     int64(settings.ToInt("cleanup_max_size")) * 1024 * 1024 * 1024,
+
+		DLNAEnabled: settings.ToBool("dlna_enabled"),
+		DLNAName:    settings.ToString("dlna_name"),
+		DLNALibrary: settings.ToBool("dlna_library"),
 
 		LocalOnlyClient: settings.ToBool("local_only_client"),
 		LogLevel:        settings.ToInt("log_level"),
@@ -823,6 +890,9 @@ func Reload() (ret *Configuration, err error) {
 	if newConfig.EndBufferSize < defaultEndBufferSize {
 		newConfig.EndBufferSize = defaultEndBufferSize
 	}
+	if newConfig.ReadaheadSeconds <= 0 {
+		newConfig.ReadaheadSeconds = defaultReadaheadSeconds
+	}
 
 	// Read Strm Language settings and cut-off ISO value
 	if strings.Contains(newConfig.StrmLanguage, " | ") {
@@ -8,6 +8,7 @@ import (
 	"os"
 	"path/filepath"
 	"strconv"
+	"sync/atomic"
 	"time"
 
 	"github.com/anacrolix/missinggo/perf"
@@ -20,6 +21,19 @@ import (
 	"github.com/elgatito/elementum/xbmc"
 )
 
+// writesSuspended is set while disk is almost full
+var writesSuspended atomic.Bool
+
+// SuspendWrites stops non-essential writes, like backups, compression and history
+func SuspendWrites(suspend bool) {
+	writesSuspended.Store(suspend)
+}
+
+// WritesSuspended checks whether non-essential writes are stopped
+func WritesSuspended() bool {
+	return writesSuspended.Load()
+}
+
 // GetBolt returns common database
 func GetBolt() *BoltDatabase {
 	return boltDatabase
@@ -99,6 +113,10 @@ func CreateBoltDB(conf *config.Configuration, databasePath, backupPath string) (
 
 // CompressBoltDB ...
 func CompressBoltDB(conf *config.Configuration, databasePath, compressPath string) error {
+	if WritesSuspended() {
+		return errors.New("Writes are suspended due to low disk space")
+	}
+
 	if util.FileExists(compressPath) {
 		if err := os.Remove(compressPath); err != nil {
 			log.Errorf("Could not remove file %s: %s", compressPath, err)
@@ -265,6 +283,9 @@ func (d *BoltDatabase) MaintenanceRefreshHandler() {
 func CreateBackup(db *bolt.DB, backupPath string) {
 	if config.Args.DisableBackup {
 		return
+	} else if WritesSuspended() {
+		log.Infof("Skipping backup due to low disk space")
+		return
 	}
 	if stat, err := os.Stat(backupPath); err == nil && time.Since(stat.ModTime()) < backupPeriod {
 		log.Infof("Skipping backup due to newer modification date of %s", backupPath)
@@ -145,7 +145,7 @@ func (d *Database) GetFilename() string {
 
 // AddSearchHistory adds query to search history, according to media type
 func (d *StormDatabase) AddSearchHistory(historyType, query string) {
-	if d == nil || d.db == nil {
+	if d == nil || d.db == nil || WritesSuspended() {
 		return
 	}
 
@@ -342,19 +342,9 @@ func (d *StormDatabase) GetBTItem(infoHash string) *BTItem {
 
 // UpdateBTItemStatus ...
 func (d *StormDatabase) UpdateBTItemStatus(infoHash string, status int) error {
-	if d == nil || d.db == nil {
-		return errors.New("Database not initialized")
-	}
-
-	defer perf.ScopeTimer()()
-
-	item := BTItem{}
-	if err := d.db.One("InfoHash", infoHash, &item); err != nil {
-		return err
-	}
-
-	item.State = status
-	return d.db.Update(&item)
+	return d.updateBTItem(infoHash, false, func(item *BTItem) {
+		item.State = status
+	})
 }
 
 // UpdateBTItem ...
@@ -382,6 +372,19 @@ func (d *StormDatabase) UpdateBTItem(infoHash string, mediaID int, mediaType str
 
 	var oldItem BTItem
 	if err := d.db.One("InfoHash", infoHash, &oldItem); err == nil {
+		// Keep per-torrent settings, they are not related to media assignment
+		item.DownloadLimit = oldItem.DownloadLimit
+		item.UploadLimit = oldItem.UploadLimit
+		item.MaxConnections = oldItem.MaxConnections
+		item.QueuePosition = oldItem.QueuePosition
+		item.SeedPolicy = oldItem.SeedPolicy
+		item.Category = oldItem.Category
+		item.Trackers = oldItem.Trackers
+		item.TrackerTiers = oldItem.TrackerTiers
+		item.Pinned = oldItem.Pinned
+		item.WatchedAt = oldItem.WatchedAt
+		item.FinishedHookFired = oldItem.FinishedHookFired
+
 		d.db.DeleteStruct(&oldItem)
 	}
 	if err := d.db.Save(&item); err != nil {
@@ -393,6 +396,75 @@ func (d *StormDatabase) UpdateBTItem(infoHash string, mediaID int, mediaType str
 
 // UpdateBTItemFiles ...
 func (d *StormDatabase) UpdateBTItemFiles(infoHash string, files []string) error {
+	return d.updateBTItem(infoHash, false, func(item *BTItem) {
+		item.Files = files
+	})
+}
+
+// UpdateBTItemLimits saves per-torrent rate limits and connections cap
+func (d *StormDatabase) UpdateBTItemLimits(infoHash string, downloadLimit, uploadLimit, maxConnections int) error {
+	return d.updateBTItem(infoHash, true, func(item *BTItem) {
+		item.DownloadLimit = downloadLimit
+		item.UploadLimit = uploadLimit
+		item.MaxConnections = maxConnections
+	})
+}
+
+// UpdateBTItemQueuePosition saves torrent position in the queue
+func (d *StormDatabase) UpdateBTItemQueuePosition(infoHash string, position int) error {
+	return d.updateBTItem(infoHash, true, func(item *BTItem) {
+		item.QueuePosition = position
+	})
+}
+
+// UpdateBTItemSeedPolicy saves per-torrent seeding policy, nil policy means global settings are used
+func (d *StormDatabase) UpdateBTItemSeedPolicy(infoHash string, policy *SeedPolicy) error {
+	return d.updateBTItem(infoHash, true, func(item *BTItem) {
+		item.SeedPolicy = policy
+	})
+}
+
+// UpdateBTItemCategory saves torrent category
+func (d *StormDatabase) UpdateBTItemCategory(infoHash string, category string) error {
+	return d.updateBTItem(infoHash, true, func(item *BTItem) {
+		item.Category = category
+	})
+}
+
+// UpdateBTItemTrackers saves edited torrent trackers with their tiers
+func (d *StormDatabase) UpdateBTItemTrackers(infoHash string, trackers []string, tiers []int) error {
+	return d.updateBTItem(infoHash, true, func(item *BTItem) {
+		item.Trackers = trackers
+		item.TrackerTiers = tiers
+	})
+}
+
+// UpdateBTItemPinned saves pin flag
+func (d *StormDatabase) UpdateBTItemPinned(infoHash string, pinned bool) error {
+	return d.updateBTItem(infoHash, true, func(item *BTItem) {
+		item.Pinned = pinned
+	})
+}
+
+// UpdateBTItemFinishedHook saves whether "finished" hooks are run
+func (d *StormDatabase) UpdateBTItemFinishedHook(infoHash string, fired bool) error {
+	return d.updateBTItem(infoHash, true, func(item *BTItem) {
+		item.FinishedHookFired = fired
+	})
+}
+
+// UpdateBTItemWatched saves the time, when torrent was watched
+func (d *StormDatabase) UpdateBTItemWatched(infoHash string, watchedAt time.Time) error {
+	return d.updateBTItem(infoHash, true, func(item *BTItem) {
+		item.WatchedAt = watchedAt
+	})
+}
+
+// updateBTItem loads stored item, applies changes and saves it.
+// Per-torrent settings use create, so they are kept for torrents without assigned media as well,
+// media assignment fields are only changed for existing items.
+// Save() is used, because Update() skips zero values, that are needed to reset settings.
+func (d *StormDatabase) updateBTItem(infoHash string, create bool, fn func(item *BTItem)) error {
 	if d == nil || d.db == nil {
 		return errors.New("Database not initialized")
 	}
@@ -401,11 +473,19 @@ func (d *StormDatabase) UpdateBTItemFiles(infoHash string, files []string) error
 
 	item := BTItem{}
 	if err := d.db.One("InfoHash", infoHash, &item); err != nil {
-		return err
+		if !create {
+			return err
+		}
+
+		item = BTItem{
+			InfoHash: infoHash,
+			State:    StateActive,
+			Files:    []string{},
+		}
 	}
 
-	item.Files = files
-	return d.db.Update(&item)
+	fn(&item)
+	return d.db.Save(&item)
 }
 
 // DeleteBTItem ...
@@ -421,7 +501,7 @@ func (d *StormDatabase) DeleteBTItem(infoHash string) error {
 
 // AddTorrentHistory saves last used torrent
 func (d *StormDatabase) AddTorrentHistory(infoHash, name string, b []byte) {
-	if d == nil || d.db == nil {
+	if d == nil || d.db == nil || WritesSuspended() {
 		return
 	}
 
@@ -463,6 +543,210 @@ func (d *StormDatabase) AddTorrentHistory(infoHash, name string, b []byte) {
 	d.db.ReIndex(&TorrentHistory{})
 }
 
+// AddTransferStats stores differences between samples and previously seen counters,
+// both per torrent and for the current day.
+func (d *StormDatabase) AddTransferStats(samples []TransferSample) error {
+	if d == nil || d.db == nil {
+		return errors.New("Database not initialized")
+	} else if len(samples) == 0 {
+		return nil
+	}
+
+	defer perf.ScopeTimer()()
+
+	tx, err := d.db.Begin(true)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	now := time.Now()
+	day := TransferStats{Day: now.Format(TransferStatsDayFormat)}
+	tx.One("Day", day.Day, &day)
+
+	for _, sample := range samples {
+		item := TorrentTransferStats{}
+		isNew := tx.One("InfoHash", sample.InfoHash, &item) != nil
+		if isNew {
+			item = TorrentTransferStats{InfoHash: sample.InfoHash, Added: now}
+		}
+
+		// Counters are reset if torrent was re-added without resume data
+		downloaded := sample.Downloaded - item.LastDownloaded
+		if downloaded < 0 {
+			downloaded = sample.Downloaded
+		}
+		uploaded := sample.Uploaded - item.LastUploaded
+		if uploaded < 0 {
+			uploaded = sample.Uploaded
+		}
+
+		item.Name = sample.Name
+		item.Downloaded += downloaded
+		item.Uploaded += uploaded
+		item.LastDownloaded = sample.Downloaded
+		item.LastUploaded = sample.Uploaded
+		item.Updated = now
+		if err := tx.Save(&item); err != nil {
+			return err
+		}
+
+		if !isNew || !sample.Baseline {
+			day.Downloaded += downloaded
+			day.Uploaded += uploaded
+		}
+	}
+
+	if err := tx.Save(&day); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// GetTransferStats returns daily stats, sorted by day
+func (d *StormDatabase) GetTransferStats() ([]TransferStats, error) {
+	if d == nil || d.db == nil {
+		return nil, errors.New("Database not initialized")
+	}
+
+	defer perf.ScopeTimer()()
+
+	var ret []TransferStats
+	if err := d.db.All(&ret); err != nil && err != storm.ErrNotFound {
+		return nil, err
+	}
+	return ret, nil
+}
+
+// GetTransferStatsSince returns bytes transferred since the day, including it
+func (d *StormDatabase) GetTransferStatsSince(day string) (downloaded, uploaded int64, err error) {
+	if d == nil || d.db == nil {
+		return 0, 0, errors.New("Database not initialized")
+	}
+
+	defer perf.ScopeTimer()()
+
+	var days []TransferStats
+	if err = d.db.Select(q.Gte("Day", day)).Find(&days); err != nil && err != storm.ErrNotFound {
+		return 0, 0, err
+	}
+
+	for _, s := range days {
+		downloaded += s.Downloaded
+		uploaded += s.Uploaded
+	}
+	return downloaded, uploaded, nil
+}
+
+// GetTorrentTransferStats returns per-torrent stats, recently updated first
+func (d *StormDatabase) GetTorrentTransferStats() ([]TorrentTransferStats, error) {
+	if d == nil || d.db == nil {
+		return nil, errors.New("Database not initialized")
+	}
+
+	defer perf.ScopeTimer()()
+
+	var ret []TorrentTransferStats
+	if err := d.db.AllByIndex("Updated", &ret, storm.Reverse()); err != nil && err != storm.ErrNotFound {
+		return nil, err
+	}
+	return ret, nil
+}
+
+// AddDownloadedItem saves files of finished download, replacing previous download of the same item
+func (d *StormDatabase) AddDownloadedItem(key, infoHash, name string, files []string) error {
+	if d == nil || d.db == nil {
+		return errors.New("Database not initialized")
+	}
+
+	defer perf.ScopeTimer()()
+
+	return d.db.Save(&DownloadedItem{
+		Key:      key,
+		InfoHash: infoHash,
+		Name:     name,
+		Files:    files,
+		Dt:       time.Now(),
+	})
+}
+
+// UpdateDownloadedItemFiles replaces files of finished download, when they are moved
+func (d *StormDatabase) UpdateDownloadedItemFiles(infoHash string, files []string) error {
+	if d == nil || d.db == nil {
+		return errors.New("Database not initialized")
+	}
+
+	defer perf.ScopeTimer()()
+
+	var items []DownloadedItem
+	if err := d.db.Find("InfoHash", infoHash, &items); err != nil {
+		if err == storm.ErrNotFound {
+			return nil
+		}
+		return err
+	}
+
+	for _, item := range items {
+		item.Files = files
+		if err := d.db.Save(&item); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// GetDownloadedItem returns finished download for the key
+func (d *StormDatabase) GetDownloadedItem(key string) *DownloadedItem {
+	if d == nil || d.db == nil {
+		return nil
+	}
+
+	defer perf.ScopeTimer()()
+
+	var item DownloadedItem
+	if err := d.db.One("Key", key, &item); err != nil {
+		return nil
+	}
+	return &item
+}
+
+// DeleteDownloadedItem ...
+func (d *StormDatabase) DeleteDownloadedItem(key string) error {
+	if d == nil || d.db == nil {
+		return errors.New("Database not initialized")
+	}
+
+	defer perf.ScopeTimer()()
+
+	return d.db.Delete(DownloadedItemBucket, key)
+}
+
+// GetQuotaState returns stored data-cap state, or an empty one
+func (d *StormDatabase) GetQuotaState() *QuotaState {
+	state := &QuotaState{}
+	if d == nil || d.db == nil {
+		return state
+	}
+
+	defer perf.ScopeTimer()()
+
+	if err := d.db.Get(QuotaBucket, "state", state); err != nil && err != storm.ErrNotFound {
+		log.Warningf("Could not get quota state: %s", err)
+	}
+	return state
+}
+
+// SetQuotaState saves data-cap state
+func (d *StormDatabase) SetQuotaState(state *QuotaState) error {
+	if d == nil || d.db == nil {
+		return errors.New("Database not initialized")
+	}
+
+	defer perf.ScopeTimer()()
+
+	return d.db.Set(QuotaBucket, "state", state)
+}
+
 // Compress ...
 func (d *StormDatabase) Compress() (err error) {
 	if d == nil || d.db == nil {
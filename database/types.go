@@ -65,6 +65,37 @@ type BTItem struct {
 	Season   int      `json:"season"`
 	Episode  int      `json:"episode"`
 	Query    string   `json:"query"`
+
+	DownloadLimit  int `json:"download_limit"`
+	UploadLimit    int `json:"upload_limit"`
+	MaxConnections int `json:"max_connections"`
+
+	QueuePosition int `json:"queue_position"`
+
+	SeedPolicy *SeedPolicy `json:"seed_policy,omitempty"`
+
+	Category string `json:"category"`
+
+	// Trackers are set when torrent trackers were edited, nil means torrent uses own trackers
+	Trackers     []string `json:"trackers,omitempty"`
+	TrackerTiers []int    `json:"tracker_tiers,omitempty"`
+
+	// Pinned torrents are never removed by cleanup policy
+	Pinned    bool      `json:"pinned"`
+	WatchedAt time.Time `json:"watched_at"`
+
+	// FinishedHookFired is set after "finished" hooks are run, libtorrent reports finish again after recheck
+	FinishedHookFired bool `json:"finished_hook_fired"`
+}
+
+// SeedPolicy overrides global seeding limits,
+// time limit is in seconds, ratio limits are in percents.
+type SeedPolicy struct {
+	SeedForever        bool `json:"seed_forever"`
+	SeedTimeLimit      int  `json:"seed_time_limit"`
+	SeedTimeRatioLimit int  `json:"seed_time_ratio_limit"`
+	ShareRatioLimit    int  `json:"share_ratio_limit"`
+	EndAction          int  `json:"end_action"`
 }
 
 // LibraryItem ...
@@ -105,6 +136,54 @@ type TorrentHistory struct {
 	Metadata []byte
 }
 
+// TransferStats keeps session-wide transferred bytes for one day
+type TransferStats struct {
+	Day        string `json:"day" storm:"id"`
+	Downloaded int64  `json:"downloaded"`
+	Uploaded   int64  `json:"uploaded"`
+}
+
+// TorrentTransferStats keeps all-time transferred bytes of a torrent, it is kept after torrent removal
+type TorrentTransferStats struct {
+	InfoHash   string    `json:"infoHash" storm:"id"`
+	Name       string    `json:"name"`
+	Downloaded int64     `json:"downloaded"`
+	Uploaded   int64     `json:"uploaded"`
+	Added      time.Time `json:"added"`
+	Updated    time.Time `json:"updated" storm:"index"`
+
+	// Libtorrent counters from the last sample, only the difference is stored
+	LastDownloaded int64 `json:"-"`
+	LastUploaded   int64 `json:"-"`
+}
+
+// TransferSample contains current all-time counters of a torrent.
+// Baseline means counters existed before recording, so they are not added to daily stats.
+type TransferSample struct {
+	InfoHash   string
+	Name       string
+	Downloaded int64
+	Uploaded   int64
+	Baseline   bool
+}
+
+// DownloadedItem keeps files of finished download for a movie or an episode,
+// it is kept after torrent removal to detect duplicates.
+type DownloadedItem struct {
+	Key      string `storm:"id"`
+	InfoHash string `storm:"index"`
+	Name     string
+	Files    []string
+	Dt       time.Time
+}
+
+// QuotaState keeps data-cap state, which should survive restarts
+type QuotaState struct {
+	Period   string   `json:"period"`
+	Notified bool     `json:"notified"`
+	Paused   []string `json:"paused"`
+}
+
 var (
 	stormFileName         = "storm.db"
 	backupStormFileName   = "storm-backup.db"
@@ -131,6 +210,9 @@ const (
 const (
 	historyMaxSize = 50
 
+	// TransferStatsDayFormat is the format of TransferStats days
+	TransferStatsDayFormat = "2006-01-02"
+
 	backupPeriod   = 5 * time.Hour
 	cleanupPeriod  = 24 * time.Hour
 	compressPeriod = 7 * 24 * time.Hour
@@ -160,4 +242,15 @@ const (
 
 	// QueryHistoryBucket ...
 	QueryHistoryBucket = "QueryHistory"
+
+	// TransferStatsBucket ...
+	TransferStatsBucket = "TransferStats"
+	// TorrentTransferStatsBucket ...
+	TorrentTransferStatsBucket = "TorrentTransferStats"
+
+	// DownloadedItemBucket ...
+	DownloadedItemBucket = "DownloadedItem"
+
+	// QuotaBucket ...
+	QuotaBucket = "Quota"
 )
@@ -0,0 +1,352 @@
+package dlna
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/elgatito/elementum/bittorrent"
+	"github.com/elgatito/elementum/config"
+	"github.com/elgatito/elementum/library/uid"
+	"github.com/elgatito/elementum/util"
+)
+
+const (
+	rootID         = "0"
+	libraryID      = "library"
+	libraryMovies  = "library/movies"
+	libraryShows   = "library/shows"
+	libraryMovie   = "library/movie/"
+	libraryShow    = "library/show/"
+	libraryEpisode = "library/episode/"
+
+	dlnaFlags = "DLNA.ORG_OP=01;DLNA.ORG_CI=0;DLNA.ORG_FLAGS=01700000000000000000000000000000"
+)
+
+// object is a container or an item of ContentDirectory
+type object struct {
+	ID       string
+	ParentID string
+	Title    string
+
+	t *bittorrent.Torrent
+	f *bittorrent.File
+}
+
+func (o *object) isContainer() bool {
+	return o.f == nil
+}
+
+func (d *Server) contentDirectory(host string) action {
+	return func(name string, args map[string]string) ([][2]string, error) {
+		switch name {
+		case "Browse":
+			return d.browse(host, args)
+		case "GetSearchCapabilities":
+			return [][2]string{{"SearchCaps", ""}}, nil
+		case "GetSortCapabilities":
+			return [][2]string{{"SortCaps", ""}}, nil
+		case "GetSystemUpdateID":
+			return [][2]string{{"Id", strconv.FormatUint(uint64(d.systemUpdateID()), 10)}}, nil
+		}
+
+		return nil, &soapError{Code: errInvalidAction, Description: "Invalid Action"}
+	}
+}
+
+func (d *Server) browse(host string, args map[string]string) ([][2]string, error) {
+	id := args["ObjectID"]
+	if id == "" {
+		id = rootID
+	}
+	start, _ := strconv.Atoi(args["StartingIndex"])
+	count, _ := strconv.Atoi(args["RequestedCount"])
+
+	var objects []*object
+	total := 0
+	switch args["BrowseFlag"] {
+	case "BrowseMetadata":
+		o := d.object(id)
+		if o == nil {
+			return nil, &soapError{Code: errNoSuchObject, Description: "No such object"}
+		}
+		objects = []*object{o}
+		total = 1
+
+	case "BrowseDirectChildren":
+		children, ok := d.children(id)
+		if !ok {
+			return nil, &soapError{Code: errNoSuchObject, Description: "No such object"}
+		}
+		total = len(children)
+
+		if start < 0 || start > total {
+			start = total
+		}
+		// Count is compared with the rest, since start+count could overflow
+		end := total
+		if count > 0 && count < total-start {
+			end = start + count
+		}
+		objects = children[start:end]
+
+	default:
+		return nil, &soapError{Code: errInvalidArgs, Description: "Invalid BrowseFlag"}
+	}
+
+	return [][2]string{
+		{"Result", didl(host, objects)},
+		{"NumberReturned", strconv.Itoa(len(objects))},
+		{"TotalMatches", strconv.Itoa(total)},
+		{"UpdateID", strconv.FormatUint(uint64(d.systemUpdateID()), 10)},
+	}, nil
+}
+
+// systemUpdateID changes, when torrents are added or removed, so clients refresh cached listings
+func (d *Server) systemUpdateID() uint32 {
+	hashes := []string{}
+	for _, t := range d.torrents() {
+		hashes = append(hashes, t.InfoHash())
+	}
+	sort.Strings(hashes)
+	joined := strings.Join(hashes, ",")
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if joined != d.hashes {
+		d.hashes = joined
+		d.updateID++
+	}
+	return d.updateID
+}
+
+func (d *Server) torrents() []*bittorrent.Torrent {
+	ret := []*bittorrent.Torrent{}
+	for _, t := range d.s.GetTorrents() {
+		if t == nil || t.Closer.IsSet() || t.IsPreview || !t.HasMetadata() {
+			continue
+		}
+		ret = append(ret, t)
+	}
+	return ret
+}
+
+// parentID returns container ID for the object, ID format defines its place in the tree
+func parentID(id string) string {
+	switch {
+	case id == rootID:
+		return "-1"
+	case id == libraryMovies || id == libraryShows:
+		return libraryID
+	case strings.HasPrefix(id, libraryMovie):
+		return libraryMovies
+	case strings.HasPrefix(id, libraryShow):
+		return libraryShows
+	case strings.HasPrefix(id, libraryEpisode):
+		parts := strings.Split(strings.TrimPrefix(id, libraryEpisode), "/")
+		return libraryShow + parts[0]
+	case strings.Contains(id, "/"):
+		return id[:strings.Index(id, "/")]
+	}
+	return rootID
+}
+
+// object looks for the object among children of its parent
+func (d *Server) object(id string) *object {
+	if id == rootID {
+		return &object{ID: rootID, ParentID: "-1", Title: d.friendlyName()}
+	}
+
+	children, _ := d.children(parentID(id))
+	for _, o := range children {
+		if o.ID == id {
+			return o
+		}
+	}
+	return nil
+}
+
+func (d *Server) children(id string) ([]*object, bool) {
+	switch {
+	case id == rootID:
+		ret := []*object{}
+		for _, t := range d.torrents() {
+			ret = append(ret, &object{ID: t.InfoHash(), ParentID: rootID, Title: t.Name(), t: t})
+		}
+		if config.Get().DLNALibrary {
+			ret = append(ret, &object{ID: libraryID, ParentID: rootID, Title: d.localizedTitle(30758, "Library")})
+		}
+		return ret, true
+
+	case strings.HasPrefix(id, "library"):
+		if !config.Get().DLNALibrary {
+			return nil, false
+		}
+		return d.libraryChildren(id)
+	}
+
+	t := d.s.GetTorrentByHash(id)
+	if t == nil || t.IsPreview {
+		return nil, false
+	}
+
+	ret := []*object{}
+	if items, err := t.Playlist(); err == nil {
+		for _, i := range items {
+			ret = append(ret, &object{ID: fmt.Sprintf("%s/%d", id, i.File.Index), ParentID: id, Title: i.Title, t: t, f: i.File})
+		}
+	}
+	return ret, true
+}
+
+// libraryChildren lists strm library items, that have active torrents,
+// since strm files can be played only by Kodi itself.
+func (d *Server) libraryChildren(id string) ([]*object, bool) {
+	switch {
+	case id == libraryID:
+		return []*object{
+			{ID: libraryMovies, ParentID: libraryID, Title: d.localizedTitle(30214, "Movies")},
+			{ID: libraryShows, ParentID: libraryID, Title: d.localizedTitle(30215, "TV Shows")},
+		}, true
+
+	case id == libraryMovies:
+		type movie struct {
+			id    int
+			title string
+		}
+		movies := []movie{}
+
+		l := uid.Get()
+		l.Mu.Movies.RLock()
+		for _, m := range l.Movies {
+			if m != nil && m.UIDs != nil && m.UIDs.TMDB != 0 && strings.HasSuffix(m.File, ".strm") {
+				movies = append(movies, movie{id: m.UIDs.TMDB, title: fmt.Sprintf("%s (%d)", m.Title, m.Year)})
+			}
+		}
+		l.Mu.Movies.RUnlock()
+
+		ret := []*object{}
+		for _, m := range movies {
+			if t := d.s.HasTorrentByID(m.id); t != nil && !t.IsPreview {
+				if f := t.PlaylistFile(0, 0); f != nil {
+					ret = append(ret, &object{ID: fmt.Sprintf("%s%d", libraryMovie, m.id), ParentID: id, Title: m.title, t: t, f: f})
+				}
+			}
+		}
+		return ret, true
+
+	case id == libraryShows:
+		ret := []*object{}
+		for _, s := range d.strmShows(0) {
+			if children, _ := d.libraryChildren(libraryShow + strconv.Itoa(s.id)); len(children) > 0 {
+				ret = append(ret, &object{ID: libraryShow + strconv.Itoa(s.id), ParentID: id, Title: s.title})
+			}
+		}
+		return ret, true
+
+	case strings.HasPrefix(id, libraryShow):
+		showID, err := strconv.Atoi(strings.TrimPrefix(id, libraryShow))
+		if err != nil {
+			return nil, false
+		}
+
+		ret := []*object{}
+		for _, s := range d.strmShows(showID) {
+			for _, e := range s.episodes {
+				t := d.s.HasTorrentByEpisode(showID, e.Season, e.Episode)
+				if t == nil || t.IsPreview {
+					continue
+				}
+				if f := t.PlaylistFile(e.Season, e.Episode); f != nil {
+					ret = append(ret, &object{
+						ID:       fmt.Sprintf("%s%d/%d/%d", libraryEpisode, showID, e.Season, e.Episode),
+						ParentID: id,
+						Title:    fmt.Sprintf("S%02dE%02d - %s", e.Season, e.Episode, e.Title),
+						t:        t,
+						f:        f,
+					})
+				}
+			}
+		}
+		return ret, true
+	}
+
+	return nil, false
+}
+
+type strmShow struct {
+	id       int
+	title    string
+	episodes []uid.Episode
+}
+
+// strmShows returns shows with strm episodes, or only the show with provided TMDB ID
+func (d *Server) strmShows(showID int) []strmShow {
+	ret := []strmShow{}
+
+	l := uid.Get()
+	l.Mu.Shows.RLock()
+	defer l.Mu.Shows.RUnlock()
+
+	for _, s := range l.Shows {
+		if s == nil || s.UIDs == nil || s.UIDs.TMDB == 0 || (showID != 0 && s.UIDs.TMDB != showID) {
+			continue
+		}
+
+		show := strmShow{id: s.UIDs.TMDB, title: s.Title}
+		for _, e := range s.Episodes {
+			if e != nil && strings.HasSuffix(e.File, ".strm") {
+				show.episodes = append(show.episodes, *e)
+			}
+		}
+		if len(show.episodes) > 0 {
+			ret = append(ret, show)
+		}
+	}
+
+	return ret
+}
+
+func sourceProtocolInfo() string {
+	types := map[string]bool{}
+	for _, t := range util.MediaMimeTypes {
+		types[t] = true
+	}
+
+	ret := []string{}
+	for t := range types {
+		ret = append(ret, fmt.Sprintf("http-get:*:%s:*", t))
+	}
+	sort.Strings(ret)
+	return strings.Join(ret, ",")
+}
+
+// didl renders objects as DIDL-Lite, items are served by TorrentFS,
+// so range requests of clients move torrent priorities like in Kodi player.
+func didl(host string, objects []*object) string {
+	var b strings.Builder
+	b.WriteString(`<DIDL-Lite xmlns="urn:schemas-upnp-org:metadata-1-0/DIDL-Lite/" xmlns:dc="http://purl.org/dc/elements/1.1/" xmlns:upnp="urn:schemas-upnp-org:metadata-1-0/upnp/" xmlns:dlna="urn:schemas-dlna-org:metadata-1-0/">`)
+
+	for _, o := range objects {
+		if o.isContainer() {
+			fmt.Fprintf(&b, `<container id="%s" parentID="%s" restricted="1" searchable="0"><dc:title>%s</dc:title><upnp:class>object.container.storageFolder</upnp:class></container>`,
+				xmlEscape(o.ID), xmlEscape(o.ParentID), xmlEscape(o.Title))
+			continue
+		}
+
+		contentType := util.MimeType(o.f.Name)
+		class := "object.item.videoItem"
+		if strings.HasPrefix(contentType, "audio/") {
+			class = "object.item.audioItem.musicTrack"
+		}
+
+		fmt.Fprintf(&b, `<item id="%s" parentID="%s" restricted="1"><dc:title>%s</dc:title><upnp:class>%s</upnp:class><res size="%d" protocolInfo="http-get:*:%s:%s">%s</res></item>`,
+			xmlEscape(o.ID), xmlEscape(o.ParentID), xmlEscape(o.Title), class,
+			o.f.Size, contentType, dlnaFlags, xmlEscape(host+"/files/"+util.EncodeFileURL(o.f.Path)))
+	}
+
+	b.WriteString(`</DIDL-Lite>`)
+	return b.String()
+}
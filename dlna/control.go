@@ -0,0 +1,134 @@
+package dlna
+
+import (
+	"encoding/xml"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+)
+
+const (
+	errInvalidAction = 401
+	errInvalidArgs   = 402
+	errNoSuchObject  = 701
+)
+
+// soapArg is a single argument of SOAP action
+type soapArg struct {
+	XMLName xml.Name
+	Value   string `xml:",chardata"`
+}
+
+type soapEnvelope struct {
+	Body struct {
+		Action struct {
+			XMLName xml.Name
+			Args    []soapArg `xml:",any"`
+		} `xml:",any"`
+	} `xml:"Body"`
+}
+
+// soapError is UPnP error, returned as SOAP fault
+type soapError struct {
+	Code        int
+	Description string
+}
+
+func (e *soapError) Error() string {
+	return fmt.Sprintf("%d %s", e.Code, e.Description)
+}
+
+// action handles SOAP action with arguments, and returns output arguments in order
+type action func(name string, args map[string]string) ([][2]string, error)
+
+func (d *Server) control(w http.ResponseWriter, r *http.Request, serviceType string, handler action) {
+	if r.Method != http.MethodPost {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+
+	body, err := io.ReadAll(io.LimitReader(r.Body, 1<<20))
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	env := &soapEnvelope{}
+	if err := xml.Unmarshal(body, env); err != nil {
+		log.Debugf("Could not parse SOAP request: %s", err)
+		writeFault(w, &soapError{Code: errInvalidAction, Description: "Invalid Action"})
+		return
+	}
+
+	name := env.Body.Action.XMLName.Local
+	if soapAction := strings.Trim(r.Header.Get("SOAPACTION"), `"`); soapAction != "" {
+		if i := strings.LastIndex(soapAction, "#"); i >= 0 {
+			name = soapAction[i+1:]
+		}
+	}
+
+	args := map[string]string{}
+	for _, a := range env.Body.Action.Args {
+		args[a.XMLName.Local] = a.Value
+	}
+
+	out, err := handler(name, args)
+	if err != nil {
+		soapErr, ok := err.(*soapError)
+		if !ok {
+			soapErr = &soapError{Code: 501, Description: err.Error()}
+		}
+		log.Debugf("SOAP action %s failed: %s", name, soapErr)
+		writeFault(w, soapErr)
+		return
+	}
+
+	var b strings.Builder
+	b.WriteString(xml.Header)
+	b.WriteString(`<s:Envelope xmlns:s="http://schemas.xmlsoap.org/soap/envelope/" s:encodingStyle="http://schemas.xmlsoap.org/soap/encoding/"><s:Body>`)
+	fmt.Fprintf(&b, `<u:%sResponse xmlns:u="%s">`, name, serviceType)
+	for _, o := range out {
+		fmt.Fprintf(&b, "<%[1]s>%[2]s</%[1]s>", o[0], xmlEscape(o[1]))
+	}
+	fmt.Fprintf(&b, `</u:%sResponse>`, name)
+	b.WriteString(`</s:Body></s:Envelope>`)
+
+	w.Header().Set("Content-Type", `text/xml; charset="utf-8"`)
+	w.Header().Set("EXT", "")
+	w.Header().Set("Server", serverString())
+	w.Write([]byte(b.String()))
+}
+
+func writeFault(w http.ResponseWriter, e *soapError) {
+	w.Header().Set("Content-Type", `text/xml; charset="utf-8"`)
+	w.WriteHeader(http.StatusInternalServerError)
+	fmt.Fprintf(w, `%s<s:Envelope xmlns:s="http://schemas.xmlsoap.org/soap/envelope/" s:encodingStyle="http://schemas.xmlsoap.org/soap/encoding/"><s:Body>`+
+		`<s:Fault><faultcode>s:Client</faultcode><faultstring>UPnPError</faultstring><detail>`+
+		`<UPnPError xmlns="urn:schemas-upnp-org:control-1-0"><errorCode>%d</errorCode><errorDescription>%s</errorDescription></UPnPError>`+
+		`</detail></s:Fault></s:Body></s:Envelope>`, xml.Header, e.Code, xmlEscape(e.Description))
+}
+
+func (d *Server) connectionManager(name string, args map[string]string) ([][2]string, error) {
+	switch name {
+	case "GetProtocolInfo":
+		return [][2]string{{"Source", sourceProtocolInfo()}, {"Sink", ""}}, nil
+	case "GetCurrentConnectionIDs":
+		return [][2]string{{"ConnectionIDs", "0"}}, nil
+	case "GetCurrentConnectionInfo":
+		if args["ConnectionID"] != "0" {
+			return nil, &soapError{Code: errInvalidArgs, Description: "Invalid connection reference"}
+		}
+		return [][2]string{
+			{"RcsID", "-1"},
+			{"AVTransportID", "-1"},
+			{"ProtocolInfo", ""},
+			{"PeerConnectionManager", ""},
+			{"PeerConnectionID", "-1"},
+			{"Direction", "Output"},
+			{"Status", "OK"},
+		}, nil
+	}
+
+	return nil, &soapError{Code: errInvalidAction, Description: "Invalid Action"}
+}
@@ -0,0 +1,205 @@
+package dlna
+
+import (
+	"crypto/md5"
+	"encoding/xml"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/op/go-logging"
+
+	"github.com/elgatito/elementum/bittorrent"
+	"github.com/elgatito/elementum/config"
+	"github.com/elgatito/elementum/util/ip"
+	"github.com/elgatito/elementum/xbmc"
+)
+
+var log = logging.MustGetLogger("dlna")
+
+const (
+	// Prefix is the path, DLNA server handlers are mounted at
+	Prefix = "/dlna/"
+
+	deviceType            = "urn:schemas-upnp-org:device:MediaServer:1"
+	contentDirectoryType  = "urn:schemas-upnp-org:service:ContentDirectory:1"
+	connectionManagerType = "urn:schemas-upnp-org:service:ConnectionManager:1"
+
+	checkInterval    = 30 * time.Second
+	announceInterval = 10 * time.Minute
+	maxAge           = 1800
+)
+
+// Server is UPnP MediaServer, presenting active torrents to devices in local network
+type Server struct {
+	mu sync.Mutex
+
+	s    *bittorrent.Service
+	uuid string
+
+	conn      *net.UDPConn
+	announced time.Time
+
+	updateID uint32
+	hashes   string
+
+	titles map[int]string
+}
+
+// NewServer ...
+func NewServer(s *bittorrent.Service) *Server {
+	hostname, _ := os.Hostname()
+
+	return &Server{
+		s:        s,
+		uuid:     deviceUUID(hostname + config.Get().Info.Profile),
+		updateID: 1,
+		titles:   map[int]string{},
+	}
+}
+
+// deviceUUID makes UUID, that stays the same across restarts, so devices do not see a new server
+func deviceUUID(seed string) string {
+	h := md5.Sum([]byte(seed))
+	return fmt.Sprintf("%x-%x-%x-%x-%x", h[0:4], h[4:6], h[6:8], h[8:10], h[10:16])
+}
+
+// Start advertises the server over SSDP while it is enabled in settings
+func (d *Server) Start() {
+	closing := d.s.Closer.C()
+	ticker := time.NewTicker(checkInterval)
+	defer ticker.Stop()
+
+	defer d.stopSSDP()
+
+	d.check()
+
+	for {
+		select {
+		case <-closing:
+			return
+
+		case <-ticker.C:
+			d.check()
+		}
+	}
+}
+
+func (d *Server) check() {
+	if !config.Get().DLNAEnabled {
+		d.stopSSDP()
+		return
+	}
+
+	if !d.isRunning() {
+		if err := d.startSSDP(); err != nil {
+			log.Warningf("Could not start SSDP: %s", err)
+			return
+		}
+		log.Infof("DLNA server %s is available at %s", d.friendlyName(), d.location())
+	}
+
+	if time.Since(d.announced) >= announceInterval {
+		d.announced = time.Now()
+		d.notify("ssdp:alive")
+	}
+}
+
+func (d *Server) isRunning() bool {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	return d.conn != nil
+}
+
+func (d *Server) friendlyName() string {
+	if name := strings.TrimSpace(config.Get().DLNAName); name != "" {
+		return name
+	}
+
+	hostname, _ := os.Hostname()
+	if hostname == "" {
+		return "Elementum"
+	}
+	return fmt.Sprintf("Elementum (%s)", hostname)
+}
+
+// localizedTitle translates addon string with local Kodi, fallback is used when Kodi is not available
+func (d *Server) localizedTitle(id int, fallback string) string {
+	d.mu.Lock()
+	title, ok := d.titles[id]
+	d.mu.Unlock()
+	if ok {
+		return title
+	}
+
+	xbmcHost, err := xbmc.GetLocalXBMCHost()
+	if xbmcHost == nil || err != nil {
+		return fallback
+	}
+	if title = xbmcHost.GetLocalizedString(id); title == "" {
+		return fallback
+	}
+
+	d.mu.Lock()
+	d.titles[id] = title
+	d.mu.Unlock()
+	return title
+}
+
+func (d *Server) location() string {
+	return ip.GetHTTPHost() + Prefix + "device.xml"
+}
+
+// ServeHTTP serves device description, service descriptions and SOAP control
+func (d *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if !config.Get().DLNAEnabled {
+		http.NotFound(w, r)
+		return
+	}
+
+	switch strings.TrimPrefix(r.URL.Path, Prefix) {
+	case "device.xml":
+		d.writeXML(w, fmt.Sprintf(deviceDescription, xmlEscape(d.friendlyName()), d.uuid, Prefix))
+	case "ContentDirectory.xml":
+		d.writeXML(w, contentDirectorySCPD)
+	case "ConnectionManager.xml":
+		d.writeXML(w, connectionManagerSCPD)
+	case "control/ContentDirectory":
+		d.control(w, r, contentDirectoryType, d.contentDirectory("http://"+r.Host))
+	case "control/ConnectionManager":
+		d.control(w, r, connectionManagerType, d.connectionManager)
+	case "event/ContentDirectory", "event/ConnectionManager":
+		d.subscribe(w, r)
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+func (d *Server) writeXML(w http.ResponseWriter, body string) {
+	w.Header().Set("Content-Type", `text/xml; charset="utf-8"`)
+	w.Write([]byte(xml.Header + body))
+}
+
+// subscribe accepts event subscriptions, events are not sent,
+// since clients request content on their own, when they browse.
+func (d *Server) subscribe(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case "SUBSCRIBE":
+		sid := r.Header.Get("SID")
+		if sid == "" {
+			sid = "uuid:" + deviceUUID(fmt.Sprintf("%s%d", r.RemoteAddr, time.Now().UnixNano()))
+		}
+		w.Header().Set("SID", sid)
+		w.Header().Set("TIMEOUT", fmt.Sprintf("Second-%d", maxAge))
+		w.WriteHeader(http.StatusOK)
+	case "UNSUBSCRIBE":
+		w.WriteHeader(http.StatusOK)
+	default:
+		w.WriteHeader(http.StatusMethodNotAllowed)
+	}
+}
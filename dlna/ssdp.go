@@ -0,0 +1,151 @@
+package dlna
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"net"
+	"net/http"
+	"runtime"
+	"strings"
+	"time"
+
+	"github.com/elgatito/elementum/util/ident"
+)
+
+const ssdpAddress = "239.255.255.250:1900"
+
+func (d *Server) startSSDP() error {
+	addr, err := net.ResolveUDPAddr("udp4", ssdpAddress)
+	if err != nil {
+		return err
+	}
+
+	conn, err := net.ListenMulticastUDP("udp4", nil, addr)
+	if err != nil {
+		return err
+	}
+
+	d.mu.Lock()
+	d.conn = conn
+	d.announced = time.Time{}
+	d.mu.Unlock()
+
+	go d.listenSSDP(conn)
+	return nil
+}
+
+func (d *Server) stopSSDP() {
+	d.mu.Lock()
+	conn := d.conn
+	d.conn = nil
+	d.mu.Unlock()
+
+	if conn == nil {
+		return
+	}
+
+	d.notify("ssdp:byebye")
+	conn.Close()
+	log.Infof("DLNA server stopped")
+}
+
+// notificationTypes are targets, the device and its services are announced for
+func (d *Server) notificationTypes() []string {
+	return []string{
+		"upnp:rootdevice",
+		"uuid:" + d.uuid,
+		deviceType,
+		contentDirectoryType,
+		connectionManagerType,
+	}
+}
+
+func (d *Server) usn(target string) string {
+	if target == "uuid:"+d.uuid {
+		return target
+	}
+	return "uuid:" + d.uuid + "::" + target
+}
+
+func (d *Server) notify(nts string) {
+	addr, err := net.ResolveUDPAddr("udp4", ssdpAddress)
+	if err != nil {
+		return
+	}
+	conn, err := net.DialUDP("udp4", nil, addr)
+	if err != nil {
+		log.Warningf("Could not send SSDP notification: %s", err)
+		return
+	}
+	defer conn.Close()
+
+	for _, nt := range d.notificationTypes() {
+		msg := fmt.Sprintf("NOTIFY * HTTP/1.1\r\n"+
+			"HOST: %s\r\n"+
+			"CACHE-CONTROL: max-age=%d\r\n"+
+			"LOCATION: %s\r\n"+
+			"NT: %s\r\n"+
+			"NTS: %s\r\n"+
+			"SERVER: %s\r\n"+
+			"USN: %s\r\n\r\n",
+			ssdpAddress, maxAge, d.location(), nt, nts, serverString(), d.usn(nt))
+
+		if _, err := conn.Write([]byte(msg)); err != nil {
+			log.Debugf("Could not send SSDP notification: %s", err)
+			return
+		}
+	}
+}
+
+func (d *Server) listenSSDP(conn *net.UDPConn) {
+	buf := make([]byte, 2048)
+	for {
+		n, from, err := conn.ReadFromUDP(buf)
+		if err != nil {
+			// Connection is closed when server is stopped
+			return
+		}
+
+		req, err := http.ReadRequest(bufio.NewReader(bytes.NewReader(buf[:n])))
+		if err != nil || req.Method != "M-SEARCH" || req.Header.Get("MAN") != `"ssdp:discover"` {
+			continue
+		}
+
+		d.answerSearch(conn, from, req.Header.Get("ST"))
+	}
+}
+
+func (d *Server) answerSearch(conn *net.UDPConn, to *net.UDPAddr, st string) {
+	targets := []string{}
+	if st == "ssdp:all" {
+		targets = d.notificationTypes()
+	} else {
+		for _, nt := range d.notificationTypes() {
+			if strings.EqualFold(nt, st) {
+				targets = append(targets, nt)
+			}
+		}
+	}
+
+	for _, target := range targets {
+		msg := fmt.Sprintf("HTTP/1.1 200 OK\r\n"+
+			"CACHE-CONTROL: max-age=%d\r\n"+
+			"DATE: %s\r\n"+
+			"EXT:\r\n"+
+			"LOCATION: %s\r\n"+
+			"SERVER: %s\r\n"+
+			"ST: %s\r\n"+
+			"USN: %s\r\n\r\n",
+			maxAge, time.Now().UTC().Format(http.TimeFormat), d.location(), serverString(), target, d.usn(target))
+
+		if _, err := conn.WriteToUDP([]byte(msg), to); err != nil {
+			log.Debugf("Could not answer SSDP search from %s: %s", to, err)
+			return
+		}
+	}
+}
+
+func serverString() string {
+	return fmt.Sprintf("%s/1.0 UPnP/1.0 Elementum/%s", runtime.GOOS, ident.GetVersion())
+}
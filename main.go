@@ -26,6 +26,7 @@ import (
 	"github.com/elgatito/elementum/broadcast"
 	"github.com/elgatito/elementum/config"
 	"github.com/elgatito/elementum/database"
+	"github.com/elgatito/elementum/dlna"
 	"github.com/elgatito/elementum/exit"
 	"github.com/elgatito/elementum/library"
 	"github.com/elgatito/elementum/lockfile"
@@ -265,6 +266,9 @@ func main() {
 		handler.ServeHTTP(w, r)
 	}))
 
+	dlnaServer := dlna.NewServer(s)
+	http.Handle(dlna.Prefix, dlnaServer)
+
 	if config.Get().GreetingEnabled {
 		if xbmcHost, _ := xbmc.GetLocalXBMCHost(); xbmcHost != nil {
 			xbmcHost.Notify("Elementum", "LOCALIZE[30208]", config.AddonIcon())
@@ -317,6 +321,7 @@ func main() {
 	go db.MaintenanceRefreshHandler()
 	go cacheDB.MaintenanceRefreshHandler()
 	go util.FreeMemoryGC()
+	go dlnaServer.Start()
 
 	localAddress := fmt.Sprintf("%s:%d", config.Args.LocalHost, config.Args.LocalPort)
 	log.Infof("Prepared in %s", time.Since(now))
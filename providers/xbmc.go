@@ -162,6 +162,15 @@ func (as *AddonSearcher) GetMovieSearchSilentObject(movie *tmdb.Movie, withAuth
 	return o
 }
 
+// GetEpisodeSearchSilentObject ...
+func (as *AddonSearcher) GetEpisodeSearchSilentObject(show *tmdb.Show, episode *tmdb.Episode, withAuth bool) *EpisodeSearchObject {
+	o := as.GetEpisodeSearchObject(show, episode)
+	o.Silent = true
+	o.SkipAuth = !withAuth
+
+	return o
+}
+
 // GetMovieSearchObject ...
 func (as *AddonSearcher) GetMovieSearchObject(movie *tmdb.Movie) *MovieSearchObject {
 	year, _ := strconv.Atoi(strings.Split(movie.ReleaseDate, "-")[0])
@@ -488,3 +497,12 @@ func (as *AddonSearcher) SearchEpisodeLinks(show *tmdb.Show, episode *tmdb.Episo
 
 	return as.call("search_episode", as.GetEpisodeSearchObject(show, episode))
 }
+
+// SearchEpisodeLinksSilent ...
+func (as *AddonSearcher) SearchEpisodeLinksSilent(show *tmdb.Show, episode *tmdb.Episode, withAuth bool) []*bittorrent.TorrentFile {
+	if show == nil || episode == nil {
+		return []*bittorrent.TorrentFile{}
+	}
+
+	return as.call("search_episode", as.GetEpisodeSearchSilentObject(show, episode, withAuth))
+}
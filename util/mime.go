@@ -0,0 +1,44 @@
+package util
+
+import (
+	"mime"
+	"path/filepath"
+	"strings"
+)
+
+// MediaMimeTypes covers media extensions, missing in system mime database, network clients rely on exact types
+var MediaMimeTypes = map[string]string{
+	".mkv":  "video/x-matroska",
+	".mk3d": "video/x-matroska",
+	".avi":  "video/x-msvideo",
+	".mp4":  "video/mp4",
+	".m4v":  "video/mp4",
+	".mov":  "video/quicktime",
+	".wmv":  "video/x-ms-wmv",
+	".webm": "video/webm",
+	".ts":   "video/mp2t",
+	".m2ts": "video/mp2t",
+	".mpg":  "video/mpeg",
+	".mpeg": "video/mpeg",
+	".flv":  "video/x-flv",
+	".mp3":  "audio/mpeg",
+	".flac": "audio/flac",
+	".m4a":  "audio/mp4",
+	".aac":  "audio/aac",
+	".ogg":  "audio/ogg",
+	".opus": "audio/ogg",
+	".wav":  "audio/wav",
+	".wma":  "audio/x-ms-wma",
+}
+
+// MimeType returns content type of a file by its extension
+func MimeType(name string) string {
+	ext := strings.ToLower(filepath.Ext(name))
+	if t, ok := MediaMimeTypes[ext]; ok {
+		return t
+	}
+	if t := mime.TypeByExtension(ext); t != "" {
+		return strings.Split(t, ";")[0]
+	}
+	return "application/octet-stream"
+}